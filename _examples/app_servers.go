@@ -21,7 +21,14 @@ func main() {
 			"GO_PACKAGE": "github.com/parkervcp/crocgodyl",
 			"EXECUTABLE": "crocgodyl",
 		},
-		Limits:        &croc.Limits{1024, 0, 1024, 10, 1, "0", false},
+		Limits: &croc.Limits{
+			Memory:  croc.MustParseByteSize("1GiB").Megabytes(),
+			Swap:    croc.SwapDisabled.Megabytes(),
+			Disk:    croc.MustParseByteSize("1GiB").Megabytes(),
+			IO:      10,
+			CPU:     1,
+			Threads: croc.NewCPUSet(0).String(),
+		},
 		FeatureLimtis: croc.FeatureLimits{1, 0, 0},
 		Deploy:        &croc.DeployDescriptor{[]int{1, 2}, false, []string{}},
 	})
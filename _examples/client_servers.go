@@ -26,7 +26,7 @@ func main() {
 	}
 	server := servers[0]
 
-	if err = client.SetServerPowerState(server.Identifier, "restart"); err != nil {
+	if err = client.SendPowerSignal(server.Identifier, croc.PowerRestart); err != nil {
 		handleError(err)
 		return
 	}
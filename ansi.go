@@ -0,0 +1,293 @@
+package crocgodyl
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+type ANSIStyle struct {
+	Foreground string `json:"foreground,omitempty"`
+	Background string `json:"background,omitempty"`
+	Bold       bool   `json:"bold,omitempty"`
+	Dim        bool   `json:"dim,omitempty"`
+	Italic     bool   `json:"italic,omitempty"`
+	Underline  bool   `json:"underline,omitempty"`
+	Reverse    bool   `json:"reverse,omitempty"`
+	Strike     bool   `json:"strike,omitempty"`
+}
+
+func (s ANSIStyle) IsZero() bool {
+	return s == ANSIStyle{}
+}
+
+type ANSISpan struct {
+	Text  string    `json:"text"`
+	Style ANSIStyle `json:"style"`
+}
+
+var ansiColors = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// StripANSI removes every escape sequence from s, leaving only printable text.
+func StripANSI(s string) string {
+	if !strings.ContainsRune(s, 0x1b) {
+		return s
+	}
+
+	sb := strings.Builder{}
+	for _, span := range ParseANSI(s) {
+		sb.WriteString(span.Text)
+	}
+
+	return sb.String()
+}
+
+// ParseANSI splits s into spans of text sharing the same SGR style. Escape
+// sequences other than SGR are dropped.
+func ParseANSI(s string) []ANSISpan {
+	var (
+		spans []ANSISpan
+		style ANSIStyle
+		text  strings.Builder
+	)
+
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		spans = append(spans, ANSISpan{Text: text.String(), Style: style})
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != 0x1b {
+			text.WriteByte(s[i])
+			continue
+		}
+
+		if i+1 >= len(s) {
+			break
+		}
+
+		switch s[i+1] {
+		case '[':
+			end := i + 2
+			for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+				end++
+			}
+			if end >= len(s) {
+				i = len(s)
+				continue
+			}
+
+			if s[end] == 'm' {
+				flush()
+				style = applySGR(style, s[i+2:end])
+			}
+			i = end
+
+		case ']':
+			end := i + 2
+			for end < len(s) {
+				if s[end] == 0x07 {
+					break
+				}
+				if s[end] == 0x1b && end+1 < len(s) && s[end+1] == '\\' {
+					end++
+					break
+				}
+				end++
+			}
+			i = end
+
+		default:
+			i++
+		}
+	}
+
+	flush()
+	return spans
+}
+
+func applySGR(style ANSIStyle, params string) ANSIStyle {
+	if params == "" {
+		return ANSIStyle{}
+	}
+
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case code == 0:
+			style = ANSIStyle{}
+		case code == 1:
+			style.Bold = true
+		case code == 2:
+			style.Dim = true
+		case code == 3:
+			style.Italic = true
+		case code == 4:
+			style.Underline = true
+		case code == 7:
+			style.Reverse = true
+		case code == 9:
+			style.Strike = true
+		case code == 22:
+			style.Bold, style.Dim = false, false
+		case code == 23:
+			style.Italic = false
+		case code == 24:
+			style.Underline = false
+		case code == 27:
+			style.Reverse = false
+		case code == 29:
+			style.Strike = false
+		case code >= 30 && code <= 37:
+			style.Foreground = ansiColors[code-30]
+		case code == 38:
+			var color string
+			color, i = extendedColor(codes, i)
+			style.Foreground = color
+		case code == 39:
+			style.Foreground = ""
+		case code >= 40 && code <= 47:
+			style.Background = ansiColors[code-40]
+		case code == 48:
+			var color string
+			color, i = extendedColor(codes, i)
+			style.Background = color
+		case code == 49:
+			style.Background = ""
+		case code >= 90 && code <= 97:
+			style.Foreground = ansiColors[code-90+8]
+		case code >= 100 && code <= 107:
+			style.Background = ansiColors[code-100+8]
+		}
+	}
+
+	return style
+}
+
+func extendedColor(codes []string, i int) (string, int) {
+	if i+1 >= len(codes) {
+		return "", i
+	}
+
+	switch codes[i+1] {
+	case "5":
+		if i+2 >= len(codes) {
+			return "", len(codes)
+		}
+		n, err := strconv.Atoi(codes[i+2])
+		if err != nil || n < 0 || n > 255 {
+			return "", i + 2
+		}
+
+		return xtermColor(n), i + 2
+
+	case "2":
+		if i+4 >= len(codes) {
+			return "", len(codes)
+		}
+
+		var rgb [3]int
+		for j := range rgb {
+			v, err := strconv.Atoi(codes[i+2+j])
+			if err != nil || v < 0 || v > 255 {
+				return "", i + 4
+			}
+			rgb[j] = v
+		}
+
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), i + 4
+	}
+
+	return "", i + 1
+}
+
+func xtermColor(n int) string {
+	if n < 16 {
+		return ansiColors[n]
+	}
+
+	if n >= 232 {
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+
+	n -= 16
+	level := func(v int) int {
+		if v == 0 {
+			return 0
+		}
+		return 55 + v*40
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+}
+
+// ANSIToHTML renders s as HTML, wrapping styled text in span elements with
+// inline styles. Unstyled text is only escaped.
+func ANSIToHTML(s string) string {
+	sb := strings.Builder{}
+
+	for _, span := range ParseANSI(s) {
+		if span.Style.IsZero() {
+			sb.WriteString(html.EscapeString(span.Text))
+			continue
+		}
+
+		sb.WriteString(`<span style="`)
+		sb.WriteString(span.Style.css())
+		sb.WriteString(`">`)
+		sb.WriteString(html.EscapeString(span.Text))
+		sb.WriteString("</span>")
+	}
+
+	return sb.String()
+}
+
+func (s ANSIStyle) css() string {
+	fg, bg := s.Foreground, s.Background
+	if s.Reverse {
+		fg, bg = bg, fg
+	}
+
+	var rules []string
+	if fg != "" {
+		rules = append(rules, "color:"+fg)
+	}
+	if bg != "" {
+		rules = append(rules, "background-color:"+bg)
+	}
+	if s.Bold {
+		rules = append(rules, "font-weight:bold")
+	}
+	if s.Dim {
+		rules = append(rules, "opacity:0.7")
+	}
+	if s.Italic {
+		rules = append(rules, "font-style:italic")
+	}
+
+	var decorations []string
+	if s.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if s.Strike {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		rules = append(rules, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	return strings.Join(rules, ";")
+}
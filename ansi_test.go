@@ -0,0 +1,87 @@
+package crocgodyl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []ANSISpan
+	}{
+		{"plain", "hello", []ANSISpan{{Text: "hello"}}},
+		{"empty", "", nil},
+		{"basic color and reset", "\x1b[31merror\x1b[0m done", []ANSISpan{
+			{Text: "error", Style: ANSIStyle{Foreground: "#cd0000"}},
+			{Text: " done"},
+		}},
+		{"combined attributes", "\x1b[1;4;42mok", []ANSISpan{
+			{Text: "ok", Style: ANSIStyle{Bold: true, Underline: true, Background: "#00cd00"}},
+		}},
+		{"bright colors", "\x1b[91;104mx", []ANSISpan{
+			{Text: "x", Style: ANSIStyle{Foreground: "#ff0000", Background: "#5c5cff"}},
+		}},
+		{"256 colors", "\x1b[38;5;196mred\x1b[38;5;244mgrey", []ANSISpan{
+			{Text: "red", Style: ANSIStyle{Foreground: "#ff0000"}},
+			{Text: "grey", Style: ANSIStyle{Foreground: "#808080"}},
+		}},
+		{"true color", "\x1b[48;2;1;2;255mbg", []ANSISpan{
+			{Text: "bg", Style: ANSIStyle{Background: "#0102ff"}},
+		}},
+		{"attribute resets", "\x1b[1;3mab\x1b[22mcd\x1b[23;39mef", []ANSISpan{
+			{Text: "ab", Style: ANSIStyle{Bold: true, Italic: true}},
+			{Text: "cd", Style: ANSIStyle{Italic: true}},
+			{Text: "ef"},
+		}},
+		{"empty sgr resets", "\x1b[32mgreen\x1b[mplain", []ANSISpan{
+			{Text: "green", Style: ANSIStyle{Foreground: "#00cd00"}},
+			{Text: "plain"},
+		}},
+		{"non sgr sequences are dropped", "\x1b[2Kline\x1b]0;title\x07end", []ANSISpan{{Text: "lineend"}}},
+		{"osc with string terminator", "a\x1b]8;;http://x\x1b\\b", []ANSISpan{{Text: "ab"}}},
+		{"truncated sequence", "text\x1b[31", []ANSISpan{{Text: "text"}}},
+		{"lone escape", "text\x1b", []ANSISpan{{Text: "text"}}},
+		{"malformed extended color", "\x1b[38;5mx", []ANSISpan{{Text: "x"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseANSI(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseANSI(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := map[string]string{
+		"plain":                                "plain",
+		"\x1b[33m[Server]\x1b[0m Done (1.2s)!": "[Server] Done (1.2s)!",
+		"\x1b[1m\x1b[38;2;255;0;0mred\x1b[m text": "red text",
+		"\x1b]0;title\x07prompt> ":                "prompt> ",
+	}
+
+	for in, want := range tests {
+		if got := StripANSI(in); got != want {
+			t.Errorf("StripANSI(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestANSIToHTML(t *testing.T) {
+	tests := map[string]string{
+		"<b> & co":                 "&lt;b&gt; &amp; co",
+		"\x1b[31mred\x1b[0m plain": `<span style="color:#cd0000">red</span> plain`,
+		"\x1b[1;4;9mx":             `<span style="font-weight:bold;text-decoration:underline line-through">x</span>`,
+		"\x1b[7;31;47mrev":         `<span style="color:#e5e5e5;background-color:#cd0000">rev</span>`,
+		"\x1b[2;3m<i>":             `<span style="opacity:0.7;font-style:italic">&lt;i&gt;</span>`,
+	}
+
+	for in, want := range tests {
+		if got := ANSIToHTML(in); got != want {
+			t.Errorf("ANSIToHTML(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
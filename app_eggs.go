@@ -32,6 +32,48 @@ type Egg struct {
 	} `json:"script"`
 	CreatedAt *time.Time `json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+
+	// configFiles keeps config.files as received, since the order of the
+	// replacements is lost in Config.Files.
+	configFiles json.RawMessage
+}
+
+func (e *Egg) UnmarshalJSON(data []byte) error {
+	type egg Egg
+	if err := json.Unmarshal(data, (*egg)(e)); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Config struct {
+			Files json.RawMessage `json:"files"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	e.configFiles = raw.Config.Files
+
+	return nil
+}
+
+// ConfigFiles decodes the configuration files Wings patches on boot from
+// Config.Files.
+func (e *Egg) ConfigFiles() (EggConfigFiles, error) {
+	data := e.configFiles
+	if len(data) == 0 {
+		var err error
+		if data, err = json.Marshal(e.Config.Files); err != nil {
+			return nil, err
+		}
+	}
+
+	var files EggConfigFiles
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
 }
 
 func (a *Application) GetEggs(nest int) ([]*Egg, error) {
@@ -0,0 +1,184 @@
+package crocgodyl
+
+import (
+	"errors"
+	"fmt"
+)
+
+type EnsureResult int
+
+const (
+	EnsureUnchanged EnsureResult = iota
+	EnsureCreated
+	EnsureUpdated
+)
+
+func (r EnsureResult) String() string {
+	switch r {
+	case EnsureCreated:
+		return "created"
+	case EnsureUpdated:
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
+
+// EnsureUser makes sure a user with the external ID of fields exists, which
+// makes retried provisioning calls safe. A missing user is created, and an
+// existing one has its fields reconciled with fields. Empty optional fields
+// are left alone on existing users, as is the password, since it cannot be
+// compared.
+func (a *Application) EnsureUser(fields CreateUserDescriptor) (*User, EnsureResult, error) {
+	if fields.ExternalID == "" {
+		return nil, EnsureUnchanged, errors.New("an external id is required")
+	}
+
+	user, err := a.GetUserExternal(fields.ExternalID)
+	if isNotFound(err) {
+		user, err = a.CreateUser(fields)
+		if err == nil {
+			return user, EnsureCreated, nil
+		}
+
+		// A concurrent call may have created the user in the meantime.
+		existing, lerr := a.GetUserExternal(fields.ExternalID)
+		if lerr != nil {
+			return nil, EnsureUnchanged, err
+		}
+		user, err = existing, nil
+	}
+	if err != nil {
+		return nil, EnsureUnchanged, err
+	}
+
+	patch := UserPatch{
+		Email:     &fields.Email,
+		Username:  &fields.Username,
+		FirstName: &fields.FirstName,
+		LastName:  &fields.LastName,
+		RootAdmin: &fields.RootAdmin,
+	}
+	if fields.Language != "" {
+		patch.Language = &fields.Language
+	}
+
+	body, changed := patch.merge(user)
+	if len(changed) == 0 {
+		return user, EnsureUnchanged, nil
+	}
+
+	user, err = a.updateUser(user.ID, body)
+	if err != nil {
+		return nil, EnsureUnchanged, err
+	}
+
+	return user, EnsureUpdated, nil
+}
+
+// EnsureServer makes sure a server with the external ID of fields exists,
+// like EnsureUser. An existing server has its details, build limits and
+// startup reconciled with fields through the respective update endpoints.
+// Allocation and Deploy are only used for creating the server.
+func (a *Application) EnsureServer(fields CreateServerDescriptor) (*AppServer, EnsureResult, error) {
+	if fields.ExternalID == "" {
+		return nil, EnsureUnchanged, errors.New("an external id is required")
+	}
+
+	server, err := a.GetServerExternal(fields.ExternalID)
+	if isNotFound(err) {
+		server, err = a.CreateServer(fields)
+		if err == nil {
+			return server, EnsureCreated, nil
+		}
+
+		existing, lerr := a.GetServerExternal(fields.ExternalID)
+		if lerr != nil {
+			return nil, EnsureUnchanged, err
+		}
+		server, err = existing, nil
+	}
+	if err != nil {
+		return nil, EnsureUnchanged, err
+	}
+
+	result := EnsureUnchanged
+
+	details := ServerDetailsPatch{Name: &fields.Name, User: &fields.User}
+	if fields.Description != "" {
+		details.Description = &fields.Description
+	}
+	if body, changed := details.merge(server); len(changed) > 0 {
+		if server, err = a.updateServer(server.ID, "details", body); err != nil {
+			return nil, result, err
+		}
+		result = EnsureUpdated
+	}
+
+	build := ServerBuildPatch{
+		OOMDisabled: &fields.OOMDisabled,
+		Databases:   &fields.FeatureLimtis.Databases,
+		Allocations: &fields.FeatureLimtis.Allocations,
+		Backups:     &fields.FeatureLimtis.Backups,
+	}
+	if l := fields.Limits; l != nil {
+		build.Memory, build.Swap, build.Disk = &l.Memory, &l.Swap, &l.Disk
+		build.IO, build.CPU, build.Threads = &l.IO, &l.CPU, &l.Threads
+	}
+	if body, changed := build.merge(server); len(changed) > 0 {
+		if server, err = a.updateServer(server.ID, "build", body); err != nil {
+			return nil, result, err
+		}
+		result = EnsureUpdated
+	}
+
+	if startup, changed := startupChanges(server, &fields); changed {
+		if server, err = a.updateServer(server.ID, "startup", startup); err != nil {
+			return nil, result, err
+		}
+		result = EnsureUpdated
+	}
+
+	return server, result, nil
+}
+
+// startupChanges returns the startup configuration of s with the values
+// requested in fields applied, and whether any of them differ. Environment
+// variables that are not mentioned in fields are kept.
+func startupChanges(s *AppServer, fields *CreateServerDescriptor) (*ServerStartupDescriptor, bool) {
+	startup := s.StartupDescriptor()
+	environment := make(map[string]interface{}, len(startup.Environment))
+	for k, v := range startup.Environment {
+		environment[k] = v
+	}
+	startup.Environment = environment
+
+	changed := false
+	if fields.Startup != "" && fields.Startup != startup.Startup {
+		startup.Startup, changed = fields.Startup, true
+	}
+	if fields.DockerImage != "" && fields.DockerImage != startup.Image {
+		startup.Image, changed = fields.DockerImage, true
+	}
+	if fields.Egg != 0 && fields.Egg != startup.Egg {
+		startup.Egg, changed = fields.Egg, true
+	}
+	for k, v := range fields.Environment {
+		if envValue(environment[k]) != envValue(v) {
+			environment[k], changed = v, true
+		}
+	}
+
+	return startup, changed
+}
+
+// envValue normalizes an environment variable value for comparison, since
+// the panel returns numbers and empty values in different types than they
+// are usually sent in.
+func envValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,106 @@
+package crocgodyl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnsureUser(t *testing.T) {
+	f := newFakeApp(t)
+	fields := CreateUserDescriptor{
+		ExternalID: "customer-1",
+		Email:      "jane@example.com",
+		Username:   "jane",
+		FirstName:  "Jane",
+		LastName:   "Doe",
+		RootAdmin:  true,
+	}
+
+	user, result, err := f.app.EnsureUser(fields)
+	if err != nil || result != EnsureCreated {
+		t.Fatalf("expected the user to be created, got %s, %v", result, err)
+	}
+	if got := f.takeWrites(); !reflect.DeepEqual(got, []string{"POST /users"}) {
+		t.Fatalf("unexpected requests %q", got)
+	}
+
+	if _, result, err = f.app.EnsureUser(fields); err != nil || result != EnsureUnchanged {
+		t.Fatalf("expected a retry to change nothing, got %s, %v", result, err)
+	}
+	if got := f.takeWrites(); len(got) != 0 {
+		t.Fatalf("unexpected requests %q", got)
+	}
+
+	// Demoting has to work as well as promoting.
+	fields.Email, fields.RootAdmin = "jane.doe@example.com", false
+	if user, result, err = f.app.EnsureUser(fields); err != nil || result != EnsureUpdated {
+		t.Fatalf("expected the user to be updated, got %s, %v", result, err)
+	}
+	if user.RootAdmin || user.Email != "jane.doe@example.com" {
+		t.Fatalf("fields were not reconciled: %+v", user)
+	}
+	if got := f.takeWrites(); !reflect.DeepEqual(got, []string{"PATCH /users/1"}) {
+		t.Fatalf("unexpected requests %q", got)
+	}
+
+	if _, _, err = f.app.EnsureUser(CreateUserDescriptor{Email: "x@example.com"}); err == nil {
+		t.Fatal("expected an external id to be required")
+	}
+}
+
+func TestEnsureServer(t *testing.T) {
+	f := newFakeApp(t)
+	fields := CreateServerDescriptor{
+		ExternalID:  "order-1",
+		Name:        "Survival",
+		User:        1,
+		Egg:         5,
+		DockerImage: "ghcr.io/pterodactyl/yolks:java_17",
+		Startup:     "java -jar server.jar",
+		Environment: map[string]interface{}{"SERVER_JARFILE": "server.jar", "MAX_PLAYERS": 20},
+		Limits:      &Limits{Memory: 1024, Disk: 2048, IO: 500, CPU: 100},
+		Allocation:  &AllocationDescriptor{Default: 7},
+	}
+
+	server, result, err := f.app.EnsureServer(fields)
+	if err != nil || result != EnsureCreated {
+		t.Fatalf("expected the server to be created, got %s, %v", result, err)
+	}
+	if got := f.takeWrites(); !reflect.DeepEqual(got, []string{"POST /servers"}) {
+		t.Fatalf("unexpected requests %q", got)
+	}
+
+	// The panel returns numbers in the environment as JSON numbers.
+	if _, result, err = f.app.EnsureServer(fields); err != nil || result != EnsureUnchanged {
+		t.Fatalf("expected a retry to change nothing, got %s, %v", result, err)
+	}
+	if got := f.takeWrites(); len(got) != 0 {
+		t.Fatalf("unexpected requests %q", got)
+	}
+
+	fields.Name = "Creative"
+	fields.Limits = &Limits{Memory: 4096, Disk: 2048, IO: 500, CPU: 100}
+	fields.Environment = map[string]interface{}{"MAX_PLAYERS": 40}
+	if server, result, err = f.app.EnsureServer(fields); err != nil || result != EnsureUpdated {
+		t.Fatalf("expected the server to be updated, got %s, %v", result, err)
+	}
+	want := []string{"PATCH /servers/1/details", "PATCH /servers/1/build", "PATCH /servers/1/startup"}
+	if got := f.takeWrites(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected requests %q", got)
+	}
+	if server.Name != "Creative" || server.Limits.Memory != 4096 || server.Allocation != 7 {
+		t.Fatalf("fields were not reconciled: %+v", server)
+	}
+	if env := server.Container.Environment; envValue(env["MAX_PLAYERS"]) != "40" || env["SERVER_JARFILE"] != "server.jar" {
+		t.Fatalf("unexpected environment %v", env)
+	}
+
+	// Only the build changed, so only the build is updated.
+	fields.Limits.CPU = 200
+	if _, result, err = f.app.EnsureServer(fields); err != nil || result != EnsureUpdated {
+		t.Fatalf("expected the server to be updated, got %s, %v", result, err)
+	}
+	if got := f.takeWrites(); !reflect.DeepEqual(got, []string{"PATCH /servers/1/build"}) {
+		t.Fatalf("unexpected requests %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -16,7 +17,13 @@ type Location struct {
 }
 
 func (a *Application) GetLocations() ([]*Location, error) {
-	req := a.newRequest("GET", "/locations", nil)
+	return a.getLocations(nil)
+}
+
+// getLocations takes a query, so that callers such as PlanSpec can ask for
+// more than the first page.
+func (a *Application) getLocations(query url.Values) ([]*Location, error) {
+	req := a.newRequest("GET", withQuery("/locations", query), nil)
 	res, err := a.Http.Do(req)
 	if err != nil {
 		return nil, err
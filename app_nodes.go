@@ -31,6 +31,11 @@ type Node struct {
 	UpdatedAt          *time.Time `json:"updated_at,omitempty"`
 }
 
+// UploadLimit returns UploadSize, which the panel stores in megabytes, in bytes.
+func (n *Node) UploadLimit() int64 {
+	return n.UploadSize * 1024 * 1024
+}
+
 func (n *Node) UpdateDescriptor() *UpdateNodeDescriptor {
 	return &UpdateNodeDescriptor{
 		Name:               n.Name,
@@ -0,0 +1,328 @@
+package crocgodyl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeApp keeps locations, nodes, allocations, users and servers in memory
+// and serves them through the application API, recording every request that
+// changes something.
+type fakeApp struct {
+	app *Application
+
+	mu          sync.Mutex
+	nextID      int
+	locations   map[int]*Location
+	nodes       map[int]*Node
+	allocations map[int][]*Allocation
+	users       map[int]*User
+	servers     map[int]*AppServer
+	writes      []string
+}
+
+func newFakeApp(t *testing.T) *fakeApp {
+	t.Helper()
+
+	f := &fakeApp{
+		locations:   map[int]*Location{},
+		nodes:       map[int]*Node{},
+		allocations: map[int][]*Allocation{},
+		users:       map[int]*User{},
+		servers:     map[int]*AppServer{},
+	}
+	notFound := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[{"code":"NotFoundHttpException","status":"404","detail":"not found"}]}`))
+	}
+	reply := func(w http.ResponseWriter, v interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"attributes": v})
+	}
+	list := func(w http.ResponseWriter, items []interface{}) {
+		data := []interface{}{}
+		for _, item := range items {
+			data = append(data, map[string]interface{}{"attributes": item})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/application"), "/"), "/")
+		if r.Method != "GET" {
+			f.writes = append(f.writes, r.Method+" /"+strings.Join(parts, "/"))
+		}
+
+		id := 0
+		if len(parts) >= 2 {
+			id, _ = strconv.Atoi(parts[1])
+		}
+
+		switch parts[0] {
+		case "locations":
+			switch {
+			case len(parts) == 1 && r.Method == "POST":
+				f.nextID++
+				loc := &Location{ID: f.nextID}
+				json.NewDecoder(r.Body).Decode(loc)
+				f.locations[loc.ID] = loc
+				w.WriteHeader(http.StatusCreated)
+				reply(w, loc)
+			case len(parts) == 1:
+				var items []interface{}
+				for _, l := range f.locations {
+					items = append(items, l)
+				}
+				list(w, items)
+			case f.locations[id] == nil:
+				notFound(w)
+			case r.Method == "PATCH":
+				json.NewDecoder(r.Body).Decode(f.locations[id])
+				reply(w, f.locations[id])
+			case r.Method == "DELETE":
+				delete(f.locations, id)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				reply(w, f.locations[id])
+			}
+
+		case "nodes":
+			switch {
+			case len(parts) == 1 && r.Method == "POST":
+				f.nextID++
+				node := &Node{}
+				json.NewDecoder(r.Body).Decode(node)
+				node.ID = f.nextID
+				f.nodes[node.ID] = node
+				w.WriteHeader(http.StatusCreated)
+				reply(w, node)
+			case len(parts) == 1:
+				var items []interface{}
+				for _, n := range f.nodes {
+					items = append(items, n)
+				}
+				list(w, items)
+			case f.nodes[id] == nil:
+				notFound(w)
+			case len(parts) == 3 && r.Method == "POST":
+				var body CreateAllocationsDescriptor
+				json.NewDecoder(r.Body).Decode(&body)
+				ports, _ := parsePorts(body.Ports)
+				for _, port := range ports {
+					f.nextID++
+					f.allocations[id] = append(f.allocations[id], &Allocation{ID: f.nextID, IP: body.IP, Alias: body.Alias, Port: int32(port)})
+				}
+				w.WriteHeader(http.StatusNoContent)
+			case len(parts) == 3:
+				var items []interface{}
+				for _, a := range f.allocations[id] {
+					items = append(items, a)
+				}
+				list(w, items)
+			case len(parts) == 4 && r.Method == "DELETE":
+				alloc, _ := strconv.Atoi(parts[3])
+				allocs := f.allocations[id][:0]
+				for _, a := range f.allocations[id] {
+					if a.ID != alloc {
+						allocs = append(allocs, a)
+					}
+				}
+				f.allocations[id] = allocs
+				w.WriteHeader(http.StatusNoContent)
+			case r.Method == "PATCH":
+				json.NewDecoder(r.Body).Decode(f.nodes[id])
+				reply(w, f.nodes[id])
+			case r.Method == "DELETE":
+				delete(f.nodes, id)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				reply(w, f.nodes[id])
+			}
+
+		case "users":
+			var user *User
+			switch {
+			case len(parts) == 3 && parts[1] == "external":
+				for _, u := range f.users {
+					if u.ExternalID == parts[2] {
+						user = u
+					}
+				}
+			case len(parts) == 2:
+				id, _ := strconv.Atoi(parts[1])
+				user = f.users[id]
+			case r.Method == "POST":
+				var body CreateUserDescriptor
+				json.NewDecoder(r.Body).Decode(&body)
+				f.nextID++
+				user = &User{
+					ID:         f.nextID,
+					ExternalID: body.ExternalID,
+					Username:   body.Username,
+					Email:      body.Email,
+					FirstName:  body.FirstName,
+					LastName:   body.LastName,
+					Language:   body.Language,
+					RootAdmin:  body.RootAdmin,
+				}
+				if user.Language == "" {
+					user.Language = "en"
+				}
+				f.users[user.ID] = user
+				w.WriteHeader(http.StatusCreated)
+				reply(w, user)
+				return
+			default:
+				var data []interface{}
+				for _, u := range f.users {
+					data = append(data, map[string]interface{}{"attributes": u})
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+				return
+			}
+			if user == nil {
+				notFound(w)
+				return
+			}
+
+			switch r.Method {
+			case "PATCH":
+				var body userUpdateBody
+				json.NewDecoder(r.Body).Decode(&body)
+				user.ExternalID, user.Email, user.Username = body.ExternalID, body.Email, body.Username
+				user.FirstName, user.LastName = body.FirstName, body.LastName
+				user.Language, user.RootAdmin = body.Language, body.RootAdmin
+			case "DELETE":
+				delete(f.users, user.ID)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			reply(w, user)
+
+		case "servers":
+			var server *AppServer
+			switch {
+			case len(parts) == 3 && parts[1] == "external":
+				for _, s := range f.servers {
+					if s.ExternalID == parts[2] {
+						server = s
+					}
+				}
+			case len(parts) >= 2:
+				id, _ := strconv.Atoi(parts[1])
+				server = f.servers[id]
+			case r.Method == "POST":
+				var body CreateServerDescriptor
+				json.NewDecoder(r.Body).Decode(&body)
+				f.nextID++
+				server = &AppServer{
+					ID:            f.nextID,
+					ExternalID:    body.ExternalID,
+					Identifier:    fmt.Sprintf("srv%05d", f.nextID),
+					Name:          body.Name,
+					Description:   body.Description,
+					User:          body.User,
+					Egg:           body.Egg,
+					FeatureLimits: body.FeatureLimtis,
+				}
+				if body.Limits != nil {
+					server.Limits = *body.Limits
+				}
+				server.Limits.OOMDisabled = body.OOMDisabled
+				if body.Allocation != nil {
+					server.Allocation = body.Allocation.Default
+					server.Node = f.allocationNode(server.Allocation)
+				}
+				server.Container.Image = body.DockerImage
+				server.Container.StartupCommand = body.Startup
+				server.Container.Environment = body.Environment
+				f.servers[server.ID] = server
+				w.WriteHeader(http.StatusCreated)
+				reply(w, server)
+				return
+			default:
+				var data []interface{}
+				for _, s := range f.servers {
+					data = append(data, map[string]interface{}{"attributes": s})
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+				return
+			}
+			if server == nil {
+				notFound(w)
+				return
+			}
+
+			endpoint := ""
+			if len(parts) == 3 {
+				endpoint = parts[2]
+			}
+			switch {
+			case r.Method == "PATCH" && endpoint == "details":
+				var body serverDetailsBody
+				json.NewDecoder(r.Body).Decode(&body)
+				server.ExternalID, server.Name = body.ExternalID, body.Name
+				server.User, server.Description = body.User, body.Description
+			case r.Method == "PATCH" && endpoint == "build":
+				var body serverBuildBody
+				json.NewDecoder(r.Body).Decode(&body)
+				server.Allocation, server.Limits, server.FeatureLimits = body.Allocation, body.Limits, body.FeatureLimits
+				server.Limits.OOMDisabled = body.OOMDisabled
+			case r.Method == "PATCH" && endpoint == "startup":
+				var body ServerStartupDescriptor
+				json.NewDecoder(r.Body).Decode(&body)
+				server.Container.StartupCommand, server.Container.Image = body.Startup, body.Image
+				server.Container.Environment, server.Egg = body.Environment, body.Egg
+			case r.Method == "DELETE":
+				delete(f.servers, server.ID)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			reply(w, server)
+
+		default:
+			t.Logf("unhandled request %s %s", r.Method, r.URL.Path)
+			notFound(w)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	app, err := NewApp(srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.app = app
+
+	return f
+}
+
+// takeWrites returns the changing requests made since the last call.
+func (f *fakeApp) takeWrites() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writes := f.writes
+	f.writes = nil
+	return writes
+}
+
+// allocationNode returns the node the allocation belongs to.
+func (f *fakeApp) allocationNode(id int) int {
+	for node, allocs := range f.allocations {
+		for _, a := range allocs {
+			if a.ID == id {
+				return node
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,217 @@
+package crocgodyl
+
+// Ptr returns a pointer to v, for filling in the fields of patches such as
+// UserPatch.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// patchField sets dst to the value v points to, if any, and records name in
+// changed when that changes dst.
+func patchField[T comparable](changed *[]string, name string, dst *T, v *T) {
+	if v == nil || *dst == *v {
+		return
+	}
+
+	*dst = *v
+	*changed = append(*changed, name)
+}
+
+// UserPatch holds the user fields to change, where nil fields are left as
+// they are. Unlike UpdateUserDescriptor it can set RootAdmin to false.
+type UserPatch struct {
+	ExternalID *string `json:"external_id,omitempty"`
+	Email      *string `json:"email,omitempty"`
+	Username   *string `json:"username,omitempty"`
+	Password   *string `json:"password,omitempty"`
+	FirstName  *string `json:"first_name,omitempty"`
+	LastName   *string `json:"last_name,omitempty"`
+	Language   *string `json:"language,omitempty"`
+	RootAdmin  *bool   `json:"root_admin,omitempty"`
+}
+
+type userUpdateBody struct {
+	ExternalID string `json:"external_id"`
+	Email      string `json:"email"`
+	Username   string `json:"username"`
+	Password   string `json:"password,omitempty"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Language   string `json:"language"`
+	RootAdmin  bool   `json:"root_admin"`
+}
+
+// merge applies the patch on top of u and returns the full update body
+// along with the names of the fields that change.
+func (p *UserPatch) merge(u *User) (*userUpdateBody, []string) {
+	body := &userUpdateBody{
+		ExternalID: u.ExternalID,
+		Email:      u.Email,
+		Username:   u.Username,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		Language:   u.Language,
+		RootAdmin:  u.RootAdmin,
+	}
+
+	var changed []string
+	patchField(&changed, "external_id", &body.ExternalID, p.ExternalID)
+	patchField(&changed, "email", &body.Email, p.Email)
+	patchField(&changed, "username", &body.Username, p.Username)
+	patchField(&changed, "first_name", &body.FirstName, p.FirstName)
+	patchField(&changed, "last_name", &body.LastName, p.LastName)
+	patchField(&changed, "language", &body.Language, p.Language)
+	patchField(&changed, "root_admin", &body.RootAdmin, p.RootAdmin)
+	if p.Password != nil {
+		body.Password = *p.Password
+		changed = append(changed, "password")
+	}
+
+	return body, changed
+}
+
+// PatchUser changes only the fields set in patch. The panel validates an
+// update as a whole, so the user is fetched first and sent back complete
+// with the patch applied. No request is made when nothing would change.
+func (a *Application) PatchUser(id int, patch UserPatch) (*User, error) {
+	user, err := a.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	body, changed := patch.merge(user)
+	if len(changed) == 0 {
+		return user, nil
+	}
+
+	return a.updateUser(id, body)
+}
+
+// ServerBuildPatch holds the build fields to change, where nil fields are
+// left as they are. Sizes are in megabytes, as returned by
+// ByteSize.Megabytes.
+type ServerBuildPatch struct {
+	Allocation        *int    `json:"allocation,omitempty"`
+	AddAllocations    []int   `json:"add_allocations,omitempty"`
+	RemoveAllocations []int   `json:"remove_allocations,omitempty"`
+	OOMDisabled       *bool   `json:"oom_disabled,omitempty"`
+	Memory            *int64  `json:"memory,omitempty"`
+	Swap              *int64  `json:"swap,omitempty"`
+	Disk              *int64  `json:"disk,omitempty"`
+	IO                *int64  `json:"io,omitempty"`
+	CPU               *int64  `json:"cpu,omitempty"`
+	Threads           *string `json:"threads,omitempty"`
+	Databases         *int    `json:"databases,omitempty"`
+	Allocations       *int    `json:"allocations,omitempty"`
+	Backups           *int    `json:"backups,omitempty"`
+}
+
+type serverBuildBody struct {
+	Allocation        int           `json:"allocation"`
+	OOMDisabled       bool          `json:"oom_disabled"`
+	Limits            Limits        `json:"limits"`
+	AddAllocations    []int         `json:"add_allocations"`
+	RemoveAllocations []int         `json:"remove_allocations"`
+	FeatureLimits     FeatureLimits `json:"feature_limits"`
+}
+
+func (p *ServerBuildPatch) merge(s *AppServer) (*serverBuildBody, []string) {
+	body := &serverBuildBody{
+		Allocation:        s.Allocation,
+		OOMDisabled:       s.Limits.OOMDisabled,
+		Limits:            s.Limits,
+		AddAllocations:    []int{},
+		RemoveAllocations: []int{},
+		FeatureLimits:     s.FeatureLimits,
+	}
+
+	var changed []string
+	patchField(&changed, "allocation", &body.Allocation, p.Allocation)
+	patchField(&changed, "oom_disabled", &body.OOMDisabled, p.OOMDisabled)
+	patchField(&changed, "limits.memory", &body.Limits.Memory, p.Memory)
+	patchField(&changed, "limits.swap", &body.Limits.Swap, p.Swap)
+	patchField(&changed, "limits.disk", &body.Limits.Disk, p.Disk)
+	patchField(&changed, "limits.io", &body.Limits.IO, p.IO)
+	patchField(&changed, "limits.cpu", &body.Limits.CPU, p.CPU)
+	patchField(&changed, "limits.threads", &body.Limits.Threads, p.Threads)
+	patchField(&changed, "feature_limits.databases", &body.FeatureLimits.Databases, p.Databases)
+	patchField(&changed, "feature_limits.allocations", &body.FeatureLimits.Allocations, p.Allocations)
+	patchField(&changed, "feature_limits.backups", &body.FeatureLimits.Backups, p.Backups)
+	body.Limits.OOMDisabled = body.OOMDisabled
+
+	if len(p.AddAllocations) > 0 {
+		body.AddAllocations = p.AddAllocations
+		changed = append(changed, "add_allocations")
+	}
+	if len(p.RemoveAllocations) > 0 {
+		body.RemoveAllocations = p.RemoveAllocations
+		changed = append(changed, "remove_allocations")
+	}
+
+	return body, changed
+}
+
+// PatchServerBuild changes only the build fields set in patch, sending the
+// rest of the current build configuration along; see PatchUser.
+func (a *Application) PatchServerBuild(id int, patch ServerBuildPatch) (*AppServer, error) {
+	server, err := a.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	body, changed := patch.merge(server)
+	if len(changed) == 0 {
+		return server, nil
+	}
+
+	return a.updateServer(id, "build", body)
+}
+
+// ServerDetailsPatch holds the detail fields to change, where nil fields
+// are left as they are. An empty ExternalID or Description clears it.
+type ServerDetailsPatch struct {
+	ExternalID  *string `json:"external_id,omitempty"`
+	Name        *string `json:"name,omitempty"`
+	User        *int    `json:"user,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+type serverDetailsBody struct {
+	ExternalID  string `json:"external_id"`
+	Name        string `json:"name"`
+	User        int    `json:"user"`
+	Description string `json:"description"`
+}
+
+func (p *ServerDetailsPatch) merge(s *AppServer) (*serverDetailsBody, []string) {
+	body := &serverDetailsBody{
+		ExternalID:  s.ExternalID,
+		Name:        s.Name,
+		User:        s.User,
+		Description: s.Description,
+	}
+
+	var changed []string
+	patchField(&changed, "external_id", &body.ExternalID, p.ExternalID)
+	patchField(&changed, "name", &body.Name, p.Name)
+	patchField(&changed, "user", &body.User, p.User)
+	patchField(&changed, "description", &body.Description, p.Description)
+
+	return body, changed
+}
+
+// PatchServerDetails changes only the detail fields set in patch; see
+// PatchUser.
+func (a *Application) PatchServerDetails(id int, patch ServerDetailsPatch) (*AppServer, error) {
+	server, err := a.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	body, changed := patch.merge(server)
+	if len(changed) == 0 {
+		return server, nil
+	}
+
+	return a.updateServer(id, "details", body)
+}
@@ -0,0 +1,125 @@
+package crocgodyl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUserPatchMerge(t *testing.T) {
+	admin := &User{Username: "alice", Email: "alice@example.com", Language: "en", RootAdmin: true}
+
+	tests := []struct {
+		name    string
+		patch   UserPatch
+		changed string
+	}{
+		{name: "empty", changed: "[]"},
+		{name: "same values", patch: UserPatch{Username: Ptr("alice"), RootAdmin: Ptr(true)}, changed: "[]"},
+		{name: "false value", patch: UserPatch{RootAdmin: Ptr(false)}, changed: "[root_admin]"},
+		{name: "empty value", patch: UserPatch{Language: Ptr("")}, changed: "[language]"},
+		{name: "password", patch: UserPatch{Password: Ptr("secret"), Email: Ptr("a@example.com")}, changed: "[email password]"},
+	}
+
+	for _, tt := range tests {
+		body, changed := tt.patch.merge(admin)
+		if got := fmt.Sprint(changed); got != tt.changed {
+			t.Errorf("%s: changed %s, want %s", tt.name, got, tt.changed)
+		}
+		if body.Username != "alice" {
+			t.Errorf("%s: the username was not kept: %+v", tt.name, body)
+		}
+	}
+
+	// The panel needs root_admin sent even when it turns false.
+	body, _ := (&UserPatch{RootAdmin: Ptr(false)}).merge(admin)
+	if b := string(mustMarshal(t, body)); !strings.Contains(b, `"root_admin":false`) || strings.Contains(b, "password") {
+		t.Fatalf("unexpected body %s", b)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+	f.users[5].RootAdmin = true
+
+	user, err := f.app.PatchUser(5, UserPatch{RootAdmin: Ptr(false), LastName: Ptr("B")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.RootAdmin || user.LastName != "B" || user.Email != "alice@example.com" || user.FirstName != "Alice" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if writes := f.takeWrites(); fmt.Sprint(writes) != "[PATCH /users/5]" {
+		t.Fatalf("unexpected writes %v", writes)
+	}
+
+	if _, err = f.app.PatchUser(5, UserPatch{RootAdmin: Ptr(false), Username: Ptr("alice")}); err != nil {
+		t.Fatal(err)
+	}
+	if writes := f.takeWrites(); len(writes) != 0 {
+		t.Fatalf("expected no request when nothing changes, got %v", writes)
+	}
+
+	if _, err = f.app.PatchUser(99, UserPatch{Email: Ptr("x@example.com")}); err == nil {
+		t.Fatal("expected a missing user to fail")
+	}
+}
+
+func TestPatchServerBuild(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+	f.servers[6].Limits.OOMDisabled = true
+	f.servers[6].FeatureLimits.Backups = 2
+
+	server, err := f.app.PatchServerBuild(6, ServerBuildPatch{OOMDisabled: Ptr(false), Memory: Ptr(GiB.Megabytes() * 2), Backups: Ptr(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Limits{Memory: 2048, Disk: 2048, IO: 500}
+	if server.Limits != want || server.FeatureLimits.Backups != 0 || server.Allocation != 3 {
+		t.Fatalf("unexpected server %+v", server)
+	}
+	if writes := f.takeWrites(); fmt.Sprint(writes) != "[PATCH /servers/6/build]" {
+		t.Fatalf("unexpected writes %v", writes)
+	}
+
+	if _, err = f.app.PatchServerBuild(6, ServerBuildPatch{OOMDisabled: Ptr(false), Disk: Ptr(int64(2048))}); err != nil {
+		t.Fatal(err)
+	}
+	if writes := f.takeWrites(); len(writes) != 0 {
+		t.Fatalf("expected no request when nothing changes, got %v", writes)
+	}
+
+	body, changed := (&ServerBuildPatch{AddAllocations: []int{4}}).merge(server)
+	if fmt.Sprint(changed) != "[add_allocations]" || fmt.Sprint(body.AddAllocations, body.RemoveAllocations) != "[4] []" {
+		t.Fatalf("unexpected merge %v, %+v", changed, body)
+	}
+	if b := string(mustMarshal(t, body)); !strings.Contains(b, `"oom_disabled":false`) || !strings.Contains(b, `"remove_allocations":[]`) {
+		t.Fatalf("unexpected body %s", b)
+	}
+}
+
+func TestPatchServerDetails(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+	f.servers[6].Description = "old"
+
+	server, err := f.app.PatchServerDetails(6, ServerDetailsPatch{Description: Ptr(""), Name: Ptr("Survival")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Description != "" || server.Name != "Survival" || server.ExternalID != "srv1" || server.User != 5 {
+		t.Fatalf("unexpected server %+v", server)
+	}
+	if writes := f.takeWrites(); fmt.Sprint(writes) != "[PATCH /servers/6/details]" {
+		t.Fatalf("unexpected writes %v", writes)
+	}
+
+	if _, err = f.app.PatchServerDetails(6, ServerDetailsPatch{User: Ptr(5)}); err != nil {
+		t.Fatal(err)
+	}
+	if writes := f.takeWrites(); len(writes) != 0 {
+		t.Fatalf("expected no request when nothing changes, got %v", writes)
+	}
+}
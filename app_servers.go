@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -64,7 +65,11 @@ func (s *AppServer) StartupDescriptor() *ServerStartupDescriptor {
 }
 
 func (a *Application) GetServers() ([]*AppServer, error) {
-	req := a.newRequest("GET", "/servers", nil)
+	return a.getServers(nil)
+}
+
+func (a *Application) getServers(query url.Values) ([]*AppServer, error) {
+	req := a.newRequest("GET", withQuery("/servers", query), nil)
 	res, err := a.Http.Do(req)
 	if err != nil {
 		return nil, err
@@ -210,28 +215,7 @@ func (a *Application) UpdateServerBuild(id int, fields ServerBuildDescriptor) (*
 		return nil, errors.New("no build fields specified")
 	}
 
-	body := bytes.Buffer{}
-	body.Write(data)
-
-	req := a.newRequest("PATCH", fmt.Sprintf("/servers/%d/build", id), &body)
-	res, err := a.Http.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	buf, err := validate(res)
-	if err != nil {
-		return nil, err
-	}
-
-	var model struct {
-		Attributes AppServer `json:"attributes"`
-	}
-	if err = json.Unmarshal(buf, &model); err != nil {
-		return nil, err
-	}
-
-	return &model.Attributes, nil
+	return a.updateServer(id, "build", fields)
 }
 
 type ServerDetailsDescriptor struct {
@@ -247,10 +231,17 @@ func (a *Application) UpdateServerDetails(id int, fields ServerDetailsDescriptor
 		return nil, errors.New("no details fields specified")
 	}
 
+	return a.updateServer(id, "details", fields)
+}
+
+// updateServer sends fields to one of the server update endpoints, which
+// are split into build, details and startup.
+func (a *Application) updateServer(id int, endpoint string, fields interface{}) (*AppServer, error) {
+	data, _ := json.Marshal(fields)
 	body := bytes.Buffer{}
 	body.Write(data)
 
-	req := a.newRequest("PATCH", fmt.Sprintf("/servers/%d/details", id), &body)
+	req := a.newRequest("PATCH", fmt.Sprintf("/servers/%d/%s", id, endpoint), &body)
 	res, err := a.Http.Do(req)
 	if err != nil {
 		return nil, err
@@ -285,28 +276,7 @@ func (a *Application) UpdateServerStartup(id int, fields ServerStartupDescriptor
 		return nil, errors.New("no startup fields specified")
 	}
 
-	body := bytes.Buffer{}
-	body.Write(data)
-
-	req := a.newRequest("PATCH", fmt.Sprintf("/servers/%d/startup", id), &body)
-	res, err := a.Http.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	buf, err := validate(res)
-	if err != nil {
-		return nil, err
-	}
-
-	var model struct {
-		Attributes AppServer `json:"attributes"`
-	}
-	if err = json.Unmarshal(buf, &model); err != nil {
-		return nil, err
-	}
-
-	return &model.Attributes, nil
+	return a.updateServer(id, "startup", fields)
 }
 
 func (a *Application) SuspendServer(id int) error {
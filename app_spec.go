@@ -0,0 +1,1015 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec describes the desired state of a panel. A section that is left out
+// is not managed: nothing of that kind is deleted, and references to it are
+// resolved against the panel. An empty section deletes everything of that
+// kind. With Protect set, deletes are planned but never applied.
+type Spec struct {
+	Protect   bool            `json:"protect" yaml:"protect"`
+	Locations []*LocationSpec `json:"locations" yaml:"locations"`
+	Nodes     []*NodeSpec     `json:"nodes" yaml:"nodes"`
+	Users     []*UserSpec     `json:"users" yaml:"users"`
+	Servers   []*ServerSpec   `json:"servers" yaml:"servers"`
+}
+
+// LocationSpec is a location, identified by its short code.
+type LocationSpec struct {
+	Short string `json:"short" yaml:"short"`
+	Long  string `json:"long" yaml:"long"`
+}
+
+// NodeSpec is a node, identified by its name. Location refers to the short
+// code of a location. When Allocations is left out the allocations of the
+// node are not managed.
+type NodeSpec struct {
+	Name               string            `json:"name" yaml:"name"`
+	Description        string            `json:"description" yaml:"description"`
+	Location           string            `json:"location" yaml:"location"`
+	Public             bool              `json:"public" yaml:"public"`
+	FQDN               string            `json:"fqdn" yaml:"fqdn"`
+	Scheme             string            `json:"scheme" yaml:"scheme"`
+	BehindProxy        bool              `json:"behind_proxy" yaml:"behind_proxy"`
+	Memory             ByteSize          `json:"memory" yaml:"memory"`
+	MemoryOverallocate int64             `json:"memory_overallocate" yaml:"memory_overallocate"`
+	Disk               ByteSize          `json:"disk" yaml:"disk"`
+	DiskOverallocate   int64             `json:"disk_overallocate" yaml:"disk_overallocate"`
+	DaemonBase         string            `json:"daemon_base" yaml:"daemon_base"`
+	DaemonSftp         int32             `json:"daemon_sftp" yaml:"daemon_sftp"`
+	DaemonListen       int32             `json:"daemon_listen" yaml:"daemon_listen"`
+	UploadSize         int64             `json:"upload_size" yaml:"upload_size"`
+	Allocations        []*AllocationSpec `json:"allocations" yaml:"allocations"`
+}
+
+// AllocationSpec is a set of allocations on one IP. Ports are single ports
+// or ranges like "25565-25570". Alias is only set when allocations are
+// created, since the API cannot change it afterwards.
+type AllocationSpec struct {
+	IP    string   `json:"ip" yaml:"ip"`
+	Alias string   `json:"alias" yaml:"alias"`
+	Ports []string `json:"ports" yaml:"ports"`
+}
+
+// UserSpec is a user, identified by their username. Password is only used
+// when the user is created, and an empty Language is left as it is.
+type UserSpec struct {
+	Username   string `json:"username" yaml:"username"`
+	Email      string `json:"email" yaml:"email"`
+	FirstName  string `json:"first_name" yaml:"first_name"`
+	LastName   string `json:"last_name" yaml:"last_name"`
+	ExternalID string `json:"external_id" yaml:"external_id"`
+	Language   string `json:"language" yaml:"language"`
+	RootAdmin  bool   `json:"root_admin" yaml:"root_admin"`
+	Password   string `json:"password" yaml:"password"`
+}
+
+// ServerSpec is a server, identified by its external ID. User refers to a
+// username, Node to a node name and Allocation to the "ip:port" of the
+// default allocation on that node. Empty startup fields are left as they
+// are on existing servers, though DockerImage and Startup are required to
+// create one, and only the listed environment variables are managed.
+type ServerSpec struct {
+	ExternalID    string                 `json:"external_id" yaml:"external_id"`
+	Name          string                 `json:"name" yaml:"name"`
+	Description   string                 `json:"description" yaml:"description"`
+	User          string                 `json:"user" yaml:"user"`
+	Node          string                 `json:"node" yaml:"node"`
+	Allocation    string                 `json:"allocation" yaml:"allocation"`
+	Egg           int                    `json:"egg" yaml:"egg"`
+	DockerImage   string                 `json:"docker_image" yaml:"docker_image"`
+	Startup       string                 `json:"startup" yaml:"startup"`
+	Environment   map[string]interface{} `json:"environment" yaml:"environment"`
+	Limits        ServerLimitsSpec       `json:"limits" yaml:"limits"`
+	FeatureLimits FeatureLimits          `json:"feature_limits" yaml:"feature_limits"`
+	OOMDisabled   bool                   `json:"oom_disabled" yaml:"oom_disabled"`
+}
+
+type ServerLimitsSpec struct {
+	Memory  ByteSize `json:"memory" yaml:"memory"`
+	Swap    SwapSize `json:"swap" yaml:"swap"`
+	Disk    ByteSize `json:"disk" yaml:"disk"`
+	IO      int64    `json:"io" yaml:"io"`
+	CPU     int64    `json:"cpu" yaml:"cpu"`
+	Threads string   `json:"threads" yaml:"threads"`
+}
+
+func (l *ServerLimitsSpec) limits(oomDisabled bool) Limits {
+	return Limits{
+		Memory:      l.Memory.Megabytes(),
+		Swap:        l.Swap.Megabytes(),
+		Disk:        l.Disk.Megabytes(),
+		IO:          l.IO,
+		CPU:         l.CPU,
+		Threads:     l.Threads,
+		OOMDisabled: oomDisabled,
+	}
+}
+
+// ParseSpec reads a spec in YAML or JSON. Unknown fields are rejected, so
+// that typos do not go unnoticed.
+func ParseSpec(data []byte) (*Spec, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	spec := &Spec{}
+	if err := dec.Decode(spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+func (s *Spec) validate() error {
+	seen := map[string]bool{}
+	unique := func(kind, key string) error {
+		if key == "" {
+			return fmt.Errorf("%s is missing its identifier", kind)
+		}
+		if seen[kind+"/"+key] {
+			return fmt.Errorf("%s %s is specified more than once", kind, key)
+		}
+		seen[kind+"/"+key] = true
+		return nil
+	}
+
+	for _, l := range s.Locations {
+		if err := unique("location", l.Short); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range s.Nodes {
+		if err := unique("node", n.Name); err != nil {
+			return err
+		}
+		if n.Location == "" || n.FQDN == "" {
+			return fmt.Errorf("node %s: location and fqdn are required", n.Name)
+		}
+		n.defaults()
+
+		for _, alloc := range n.Allocations {
+			if net.ParseIP(alloc.IP) == nil {
+				return fmt.Errorf("node %s: invalid allocation ip %q", n.Name, alloc.IP)
+			}
+			ports, err := parsePorts(alloc.Ports)
+			if err != nil {
+				return fmt.Errorf("node %s: %w", n.Name, err)
+			}
+			for _, port := range ports {
+				if err = unique("allocation", n.Name+"/"+allocationAddr(alloc.IP, port)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, u := range s.Users {
+		if err := unique("user", u.Username); err != nil {
+			return err
+		}
+		if u.Email == "" || u.FirstName == "" || u.LastName == "" {
+			return fmt.Errorf("user %s: email, first_name and last_name are required", u.Username)
+		}
+	}
+
+	for _, srv := range s.Servers {
+		if err := unique("server", srv.ExternalID); err != nil {
+			return err
+		}
+		if srv.Name == "" || srv.User == "" || srv.Node == "" || srv.Egg == 0 {
+			return fmt.Errorf("server %s: name, user, node and egg are required", srv.ExternalID)
+		}
+		if _, _, err := net.SplitHostPort(srv.Allocation); err != nil {
+			return fmt.Errorf("server %s: invalid allocation %q", srv.ExternalID, srv.Allocation)
+		}
+
+		limits := srv.Limits.limits(srv.OOMDisabled)
+		if err := limits.Validate(); err != nil {
+			return fmt.Errorf("server %s: %w", srv.ExternalID, err)
+		}
+	}
+
+	return nil
+}
+
+// validateCreate checks the fields that are optional for existing servers
+// but that the panel requires to create one.
+func (s *ServerSpec) validateCreate() error {
+	if s.DockerImage == "" || s.Startup == "" {
+		return fmt.Errorf("server %s: docker_image and startup are required to create it", s.ExternalID)
+	}
+
+	return nil
+}
+
+func (n *NodeSpec) defaults() {
+	if n.Scheme == "" {
+		n.Scheme = "https"
+	}
+	if n.DaemonBase == "" {
+		n.DaemonBase = "/var/lib/pterodactyl/volumes"
+	}
+	if n.DaemonSftp == 0 {
+		n.DaemonSftp = 2022
+	}
+	if n.DaemonListen == 0 {
+		n.DaemonListen = 8080
+	}
+	if n.UploadSize == 0 {
+		n.UploadSize = 100
+	}
+}
+
+// parsePorts expands a list of ports and port ranges.
+func parsePorts(list []string) ([]int, error) {
+	var ports []int
+	for _, p := range list {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(p), "-")
+		if !isRange {
+			hi = lo
+		}
+
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		last, err := strconv.Atoi(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		if first < 1 || last > 65535 || first > last {
+			return nil, fmt.Errorf("invalid port range %q", p)
+		}
+
+		for port := first; port <= last; port++ {
+			ports = append(ports, port)
+		}
+	}
+
+	return ports, nil
+}
+
+func allocationAddr(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+type PlanAction string
+
+const (
+	PlanCreate PlanAction = "create"
+	PlanUpdate PlanAction = "update"
+	PlanDelete PlanAction = "delete"
+)
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new"`
+}
+
+// PlanChange is a single create, update or delete of a plan. Blocked
+// deletes are skipped by ApplySpecPlan.
+type PlanChange struct {
+	Action  PlanAction    `json:"action"`
+	Kind    string        `json:"kind"`
+	Name    string        `json:"name"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+	Blocked bool          `json:"blocked,omitempty"`
+	Applied bool          `json:"applied,omitempty"`
+
+	apply func(a *Application, st *specState) error
+}
+
+// Plan is the list of changes needed to bring the panel to a spec, in the
+// order they are applied: creates and updates from locations to servers,
+// then deletes from servers back to locations.
+type Plan struct {
+	Changes []*PlanChange `json:"changes"`
+
+	state *specState
+}
+
+// Empty reports whether applying the plan would change nothing, which is
+// also the case when all that is left are blocked deletes.
+func (p *Plan) Empty() bool {
+	for _, c := range p.Changes {
+		if !c.Blocked {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+func (p *Plan) String() string {
+	symbols := map[PlanAction]string{PlanCreate: "+", PlanUpdate: "~", PlanDelete: "-"}
+
+	sb := &strings.Builder{}
+	for _, c := range p.Changes {
+		fmt.Fprintf(sb, "%s %s %s", symbols[c.Action], c.Kind, c.Name)
+		if c.Blocked {
+			sb.WriteString(" (protected)")
+		}
+		sb.WriteByte('\n')
+
+		for _, f := range c.Fields {
+			if c.Action == PlanCreate {
+				fmt.Fprintf(sb, "    %s: %q\n", f.Field, f.New)
+			} else {
+				fmt.Fprintf(sb, "    %s: %q -> %q\n", f.Field, f.Old, f.New)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// specState maps the identifiers used in a spec to panel IDs, and is kept
+// up to date while a plan is applied so later changes can refer to objects
+// created by earlier ones.
+type specState struct {
+	locations   map[string]int
+	nodes       map[string]int
+	allocations map[string]int
+	users       map[string]int
+
+	locationNames map[int]string
+	nodeNames     map[int]string
+	userNames     map[int]string
+	allocAddrs    map[int]string
+}
+
+// allPages is passed to list endpoints that accept a query, since the panel
+// paginates them.
+var allPages = url.Values{"per_page": {"10000"}}
+
+func (st *specState) loadAllocations(a *Application, node string, id int) ([]*Allocation, error) {
+	allocs, err := a.GetNodeAllocations(id, allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alloc := range allocs {
+		addr := allocationAddr(alloc.IP, int(alloc.Port))
+		st.allocations[node+"/"+addr] = alloc.ID
+		st.allocAddrs[alloc.ID] = addr
+	}
+
+	return allocs, nil
+}
+
+// specValue is a field of an object in the form compared by a plan.
+type specValue struct {
+	name, value string
+}
+
+func diffValues(current map[string]string, desired []specValue) []FieldChange {
+	var fields []FieldChange
+	for _, v := range desired {
+		old, ok := current[v.name]
+		if current != nil && ok && old == v.value {
+			continue
+		}
+		fields = append(fields, FieldChange{Field: v.name, Old: old, New: v.value})
+	}
+
+	return fields
+}
+
+func valueMap(values []specValue) map[string]string {
+	m := make(map[string]string, len(values))
+	for _, v := range values {
+		m[v.name] = v.value
+	}
+
+	return m
+}
+
+func itoa[T int | int32 | int64](v T) string {
+	return strconv.FormatInt(int64(v), 10)
+}
+
+// PlanSpec reads the current state of the panel and works out the changes
+// needed to match spec. Nothing is changed until the plan is passed to
+// ApplySpecPlan.
+func (a *Application) PlanSpec(spec *Spec) (*Plan, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	st := &specState{
+		locations:     map[string]int{},
+		nodes:         map[string]int{},
+		allocations:   map[string]int{},
+		users:         map[string]int{},
+		locationNames: map[int]string{},
+		nodeNames:     map[int]string{},
+		userNames:     map[int]string{},
+		allocAddrs:    map[int]string{},
+	}
+	plan := &Plan{Changes: []*PlanChange{}, state: st}
+	// Deletes are collected per kind, in the order locations, nodes,
+	// allocations, users and servers, and applied in reverse.
+	var deletes [5][]*PlanChange
+
+	locations, err := a.getLocations(allPages)
+	if err != nil {
+		return nil, err
+	}
+	currentLocations := map[string]*Location{}
+	for _, l := range locations {
+		st.locations[l.Short], st.locationNames[l.ID] = l.ID, l.Short
+		currentLocations[l.Short] = l
+	}
+
+	nodes, err := a.GetNodes(allPages)
+	if err != nil {
+		return nil, err
+	}
+	currentNodes := map[string]*Node{}
+	nodeAllocations := map[string][]*Allocation{}
+	for _, n := range nodes {
+		st.nodes[n.Name], st.nodeNames[n.ID] = n.ID, n.Name
+		currentNodes[n.Name] = n
+		if nodeAllocations[n.Name], err = st.loadAllocations(a, n.Name, n.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := a.getUsers(allPages)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		st.users[u.Username], st.userNames[u.ID] = u.ID, u.Username
+	}
+
+	servers, err := a.getServers(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	// References may point to objects the plan creates.
+	for _, l := range spec.Locations {
+		if _, ok := st.locations[l.Short]; !ok {
+			st.locations[l.Short] = 0
+		}
+	}
+	for _, n := range spec.Nodes {
+		if _, ok := st.nodes[n.Name]; !ok {
+			st.nodes[n.Name] = 0
+		}
+	}
+	for _, u := range spec.Users {
+		if _, ok := st.users[u.Username]; !ok {
+			st.users[u.Username] = 0
+		}
+	}
+
+	// Locations
+	wanted := map[string]bool{}
+	for _, l := range spec.Locations {
+		l := l
+		wanted[l.Short] = true
+		desired := []specValue{{"short", l.Short}, {"long", l.Long}}
+
+		current := currentLocations[l.Short]
+		if current == nil {
+			plan.add(PlanCreate, "location", l.Short, diffValues(nil, desired), func(a *Application, st *specState) error {
+				loc, err := a.CreateLocation(l.Short, l.Long)
+				if err == nil {
+					st.locations[l.Short] = loc.ID
+				}
+				return err
+			})
+			continue
+		}
+
+		if fields := diffValues(valueMap([]specValue{{"short", current.Short}, {"long", current.Long}}), desired); len(fields) > 0 {
+			plan.add(PlanUpdate, "location", l.Short, fields, func(a *Application, st *specState) error {
+				_, err := a.UpdateLocation(current.ID, l.Short, l.Long)
+				return err
+			})
+		}
+	}
+	if spec.Locations != nil {
+		for _, l := range locations {
+			if !wanted[l.Short] {
+				id := l.ID
+				deletes[0] = append(deletes[0], newDelete("location", l.Short, func(a *Application, st *specState) error {
+					return a.DeleteLocation(id)
+				}))
+			}
+		}
+	}
+
+	// Nodes and their allocations
+	wanted = map[string]bool{}
+	for _, n := range spec.Nodes {
+		n := n
+		wanted[n.Name] = true
+		if _, ok := st.locations[n.Location]; !ok {
+			return nil, fmt.Errorf("node %s: unknown location %s", n.Name, n.Location)
+		}
+
+		desired := n.values()
+		current := currentNodes[n.Name]
+		if current == nil {
+			plan.add(PlanCreate, "node", n.Name, diffValues(nil, desired), func(a *Application, st *specState) error {
+				node, err := a.CreateNode(CreateNodeDescriptor(n.descriptor(st)))
+				if err == nil {
+					st.nodes[n.Name], st.nodeNames[node.ID] = node.ID, n.Name
+				}
+				return err
+			})
+		} else if fields := diffValues(st.nodeValues(current), desired); len(fields) > 0 {
+			plan.add(PlanUpdate, "node", n.Name, fields, func(a *Application, st *specState) error {
+				_, err := a.UpdateNode(current.ID, n.descriptor(st))
+				return err
+			})
+		}
+
+		if n.Allocations != nil {
+			deletes[2] = append(deletes[2], plan.addAllocations(n, nodeAllocations[n.Name])...)
+		}
+	}
+	if spec.Nodes != nil {
+		for _, n := range nodes {
+			if !wanted[n.Name] {
+				id := n.ID
+				deletes[1] = append(deletes[1], newDelete("node", n.Name, func(a *Application, st *specState) error {
+					return a.DeleteNode(id)
+				}))
+			}
+		}
+	}
+
+	// Users
+	wanted = map[string]bool{}
+	for _, u := range spec.Users {
+		u := u
+		wanted[u.Username] = true
+		patch := u.patch()
+
+		var current *User
+		for _, cur := range users {
+			if cur.Username == u.Username {
+				current = cur
+			}
+		}
+		if current == nil {
+			plan.add(PlanCreate, "user", u.Username, diffValues(nil, u.values()), func(a *Application, st *specState) error {
+				user, err := a.CreateUser(CreateUserDescriptor{
+					ExternalID: u.ExternalID,
+					Email:      u.Email,
+					Username:   u.Username,
+					Password:   u.Password,
+					FirstName:  u.FirstName,
+					LastName:   u.LastName,
+					Language:   u.Language,
+					RootAdmin:  u.RootAdmin,
+				})
+				if err == nil {
+					st.users[u.Username], st.userNames[user.ID] = user.ID, u.Username
+				}
+				return err
+			})
+			continue
+		}
+
+		if fields := diffValues(userValues(current), u.values()); len(fields) > 0 {
+			plan.add(PlanUpdate, "user", u.Username, fields, func(a *Application, st *specState) error {
+				body, _ := patch.merge(current)
+				_, err := a.updateUser(current.ID, body)
+				return err
+			})
+		}
+	}
+	if spec.Users != nil {
+		for _, u := range users {
+			if !wanted[u.Username] {
+				id := u.ID
+				deletes[3] = append(deletes[3], newDelete("user", u.Username, func(a *Application, st *specState) error {
+					return a.DeleteUser(id)
+				}))
+			}
+		}
+	}
+
+	// Servers
+	wanted = map[string]bool{}
+	for _, s := range spec.Servers {
+		s := s
+		wanted[s.ExternalID] = true
+		if _, ok := st.users[s.User]; !ok {
+			return nil, fmt.Errorf("server %s: unknown user %s", s.ExternalID, s.User)
+		}
+		if _, ok := st.nodes[s.Node]; !ok {
+			return nil, fmt.Errorf("server %s: unknown node %s", s.ExternalID, s.Node)
+		}
+
+		var current *AppServer
+		for _, cur := range servers {
+			if cur.ExternalID == s.ExternalID {
+				current = cur
+			}
+		}
+		if current == nil {
+			if err := s.validateCreate(); err != nil {
+				return nil, err
+			}
+			plan.add(PlanCreate, "server", s.ExternalID, diffValues(nil, s.values()), func(a *Application, st *specState) error {
+				fields, err := s.descriptor(st)
+				if err != nil {
+					return err
+				}
+				_, err = a.CreateServer(*fields)
+				return err
+			})
+			continue
+		}
+
+		if node := st.nodeNames[current.Node]; node != s.Node {
+			return nil, fmt.Errorf("server %s: cannot be moved from node %s to %s", s.ExternalID, node, s.Node)
+		}
+		if fields := diffValues(st.serverValues(current, s), s.values()); len(fields) > 0 {
+			plan.add(PlanUpdate, "server", s.ExternalID, fields, func(a *Application, st *specState) error {
+				return a.updateSpecServer(st, current, s)
+			})
+		}
+	}
+	if spec.Servers != nil {
+		for _, s := range servers {
+			if !wanted[s.ExternalID] {
+				id, name := s.ID, s.ExternalID
+				if name == "" {
+					name = fmt.Sprintf("%s (#%d)", s.Name, s.ID)
+				}
+				deletes[4] = append(deletes[4], newDelete("server", name, func(a *Application, st *specState) error {
+					return a.DeleteServer(id, false)
+				}))
+			}
+		}
+	}
+
+	for i := len(deletes) - 1; i >= 0; i-- {
+		for _, c := range deletes[i] {
+			c.Blocked = spec.Protect
+			plan.Changes = append(plan.Changes, c)
+		}
+	}
+
+	return plan, nil
+}
+
+func (p *Plan) add(action PlanAction, kind, name string, fields []FieldChange, apply func(*Application, *specState) error) {
+	p.Changes = append(p.Changes, &PlanChange{Action: action, Kind: kind, Name: name, Fields: fields, apply: apply})
+}
+
+func newDelete(kind, name string, apply func(*Application, *specState) error) *PlanChange {
+	return &PlanChange{Action: PlanDelete, Kind: kind, Name: name, apply: apply}
+}
+
+// addAllocations plans creating the missing allocations of n, one change
+// per IP, and returns the deletes of the ones not in the spec.
+func (p *Plan) addAllocations(n *NodeSpec, current []*Allocation) []*PlanChange {
+	existing := map[string]*Allocation{}
+	for _, alloc := range current {
+		existing[allocationAddr(alloc.IP, int(alloc.Port))] = alloc
+	}
+
+	wanted := map[string]bool{}
+	for _, spec := range n.Allocations {
+		spec := spec
+		ports, _ := parsePorts(spec.Ports)
+
+		var missing []string
+		for _, port := range ports {
+			addr := allocationAddr(spec.IP, port)
+			wanted[addr] = true
+			if existing[addr] == nil {
+				missing = append(missing, strconv.Itoa(port))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		name := fmt.Sprintf("%s %s", n.Name, spec.IP)
+		fields := []FieldChange{{Field: "ports", New: strings.Join(missing, ",")}}
+		if spec.Alias != "" {
+			fields = append(fields, FieldChange{Field: "alias", New: spec.Alias})
+		}
+
+		p.add(PlanCreate, "allocation", name, fields, func(a *Application, st *specState) error {
+			id := st.nodes[n.Name]
+			err := a.CreateNodeAllocations(id, CreateAllocationsDescriptor{IP: spec.IP, Alias: spec.Alias, Ports: missing})
+			if err != nil {
+				return err
+			}
+			_, err = st.loadAllocations(a, n.Name, id)
+			return err
+		})
+	}
+
+	var deletes []*PlanChange
+	for _, alloc := range current {
+		addr := allocationAddr(alloc.IP, int(alloc.Port))
+		if wanted[addr] {
+			continue
+		}
+
+		id := alloc.ID
+		deletes = append(deletes, newDelete("allocation", n.Name+" "+addr, func(a *Application, st *specState) error {
+			return a.DeleteNodeAllocation(st.nodes[n.Name], id)
+		}))
+	}
+	sort.Slice(deletes, func(i, j int) bool {
+		return deletes[i].Name < deletes[j].Name
+	})
+
+	return deletes
+}
+
+func (n *NodeSpec) values() []specValue {
+	return []specValue{
+		{"name", n.Name},
+		{"description", n.Description},
+		{"location", n.Location},
+		{"public", strconv.FormatBool(n.Public)},
+		{"fqdn", n.FQDN},
+		{"scheme", n.Scheme},
+		{"behind_proxy", strconv.FormatBool(n.BehindProxy)},
+		{"memory", itoa(n.Memory.Megabytes())},
+		{"memory_overallocate", itoa(n.MemoryOverallocate)},
+		{"disk", itoa(n.Disk.Megabytes())},
+		{"disk_overallocate", itoa(n.DiskOverallocate)},
+		{"daemon_base", n.DaemonBase},
+		{"daemon_sftp", itoa(n.DaemonSftp)},
+		{"daemon_listen", itoa(n.DaemonListen)},
+		{"upload_size", itoa(n.UploadSize)},
+	}
+}
+
+func (st *specState) nodeValues(n *Node) map[string]string {
+	return valueMap([]specValue{
+		{"name", n.Name},
+		{"description", n.Description},
+		{"location", st.locationNames[n.LocationID]},
+		{"public", strconv.FormatBool(n.Public)},
+		{"fqdn", n.FQDN},
+		{"scheme", n.Scheme},
+		{"behind_proxy", strconv.FormatBool(n.BehindProxy)},
+		{"memory", itoa(n.Memory)},
+		{"memory_overallocate", itoa(n.MemoryOverallocate)},
+		{"disk", itoa(n.Disk)},
+		{"disk_overallocate", itoa(n.DiskOverallocate)},
+		{"daemon_base", n.DaemonBase},
+		{"daemon_sftp", itoa(n.DaemonSftp)},
+		{"daemon_listen", itoa(n.DaemonListen)},
+		{"upload_size", itoa(n.UploadSize)},
+	})
+}
+
+func (n *NodeSpec) descriptor(st *specState) UpdateNodeDescriptor {
+	return UpdateNodeDescriptor{
+		Name:               n.Name,
+		Description:        n.Description,
+		LocationID:         st.locations[n.Location],
+		Public:             n.Public,
+		FQDN:               n.FQDN,
+		Scheme:             n.Scheme,
+		BehindProxy:        n.BehindProxy,
+		Memory:             n.Memory.Megabytes(),
+		MemoryOverallocate: n.MemoryOverallocate,
+		Disk:               n.Disk.Megabytes(),
+		DiskOverallocate:   n.DiskOverallocate,
+		DaemonBase:         n.DaemonBase,
+		DaemonSftp:         n.DaemonSftp,
+		DaemonListen:       n.DaemonListen,
+		UploadSize:         n.UploadSize,
+	}
+}
+
+func (u *UserSpec) values() []specValue {
+	values := []specValue{
+		{"email", u.Email},
+		{"first_name", u.FirstName},
+		{"last_name", u.LastName},
+		{"external_id", u.ExternalID},
+		{"root_admin", strconv.FormatBool(u.RootAdmin)},
+	}
+	if u.Language != "" {
+		values = append(values, specValue{"language", u.Language})
+	}
+
+	return values
+}
+
+func userValues(u *User) map[string]string {
+	return valueMap([]specValue{
+		{"email", u.Email},
+		{"first_name", u.FirstName},
+		{"last_name", u.LastName},
+		{"external_id", u.ExternalID},
+		{"root_admin", strconv.FormatBool(u.RootAdmin)},
+		{"language", u.Language},
+	})
+}
+
+func (u *UserSpec) patch() UserPatch {
+	patch := UserPatch{
+		ExternalID: &u.ExternalID,
+		Email:      &u.Email,
+		FirstName:  &u.FirstName,
+		LastName:   &u.LastName,
+		RootAdmin:  &u.RootAdmin,
+	}
+	if u.Language != "" {
+		patch.Language = &u.Language
+	}
+
+	return patch
+}
+
+func (s *ServerSpec) values() []specValue {
+	limits := s.Limits.limits(s.OOMDisabled)
+	values := []specValue{
+		{"name", s.Name},
+		{"description", s.Description},
+		{"user", s.User},
+		{"node", s.Node},
+		{"allocation", s.Allocation},
+		{"egg", itoa(s.Egg)},
+		{"limits.memory", itoa(limits.Memory)},
+		{"limits.swap", itoa(limits.Swap)},
+		{"limits.disk", itoa(limits.Disk)},
+		{"limits.io", itoa(limits.IO)},
+		{"limits.cpu", itoa(limits.CPU)},
+		{"limits.threads", limits.Threads},
+		{"feature_limits.databases", itoa(s.FeatureLimits.Databases)},
+		{"feature_limits.allocations", itoa(s.FeatureLimits.Allocations)},
+		{"feature_limits.backups", itoa(s.FeatureLimits.Backups)},
+		{"oom_disabled", strconv.FormatBool(s.OOMDisabled)},
+	}
+	if s.DockerImage != "" {
+		values = append(values, specValue{"docker_image", s.DockerImage})
+	}
+	if s.Startup != "" {
+		values = append(values, specValue{"startup", s.Startup})
+	}
+
+	keys := make([]string, 0, len(s.Environment))
+	for k := range s.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values = append(values, specValue{"environment." + k, envValue(s.Environment[k])})
+	}
+
+	return values
+}
+
+func (st *specState) serverValues(s *AppServer, spec *ServerSpec) map[string]string {
+	values := valueMap([]specValue{
+		{"name", s.Name},
+		{"description", s.Description},
+		{"user", st.userNames[s.User]},
+		{"node", st.nodeNames[s.Node]},
+		{"allocation", st.allocAddrs[s.Allocation]},
+		{"egg", itoa(s.Egg)},
+		{"limits.memory", itoa(s.Limits.Memory)},
+		{"limits.swap", itoa(s.Limits.Swap)},
+		{"limits.disk", itoa(s.Limits.Disk)},
+		{"limits.io", itoa(s.Limits.IO)},
+		{"limits.cpu", itoa(s.Limits.CPU)},
+		{"limits.threads", s.Limits.Threads},
+		{"feature_limits.databases", itoa(s.FeatureLimits.Databases)},
+		{"feature_limits.allocations", itoa(s.FeatureLimits.Allocations)},
+		{"feature_limits.backups", itoa(s.FeatureLimits.Backups)},
+		{"oom_disabled", strconv.FormatBool(s.Limits.OOMDisabled)},
+		{"docker_image", s.Container.Image},
+		{"startup", s.Container.StartupCommand},
+	})
+	for k, v := range s.Container.Environment {
+		values["environment."+k] = envValue(v)
+	}
+
+	return values
+}
+
+// descriptor builds the creation request for the server, resolving its
+// references to objects that may have been created while applying.
+func (s *ServerSpec) descriptor(st *specState) (*CreateServerDescriptor, error) {
+	alloc, ok := st.allocations[s.Node+"/"+s.Allocation]
+	if !ok {
+		return nil, fmt.Errorf("allocation %s does not exist on node %s", s.Allocation, s.Node)
+	}
+
+	environment := s.Environment
+	if environment == nil {
+		environment = map[string]interface{}{}
+	}
+
+	limits := s.Limits.limits(s.OOMDisabled)
+	return &CreateServerDescriptor{
+		ExternalID:    s.ExternalID,
+		Name:          s.Name,
+		Description:   s.Description,
+		User:          st.users[s.User],
+		Egg:           s.Egg,
+		DockerImage:   s.DockerImage,
+		Startup:       s.Startup,
+		Environment:   environment,
+		OOMDisabled:   s.OOMDisabled,
+		Limits:        &limits,
+		FeatureLimtis: s.FeatureLimits,
+		Allocation:    &AllocationDescriptor{Default: alloc},
+	}, nil
+}
+
+func (a *Application) updateSpecServer(st *specState, current *AppServer, s *ServerSpec) error {
+	fields, err := s.descriptor(st)
+	if err != nil {
+		return err
+	}
+
+	details := ServerDetailsPatch{Name: &fields.Name, User: &fields.User, Description: &fields.Description}
+	if body, changed := details.merge(current); len(changed) > 0 {
+		if _, err = a.updateServer(current.ID, "details", body); err != nil {
+			return err
+		}
+	}
+
+	build := ServerBuildPatch{
+		OOMDisabled: &fields.OOMDisabled,
+		Memory:      &fields.Limits.Memory,
+		Swap:        &fields.Limits.Swap,
+		Disk:        &fields.Limits.Disk,
+		IO:          &fields.Limits.IO,
+		CPU:         &fields.Limits.CPU,
+		Threads:     &fields.Limits.Threads,
+		Databases:   &fields.FeatureLimtis.Databases,
+		Allocations: &fields.FeatureLimtis.Allocations,
+		Backups:     &fields.FeatureLimtis.Backups,
+	}
+	if alloc := fields.Allocation.Default; alloc != current.Allocation {
+		build.Allocation, build.AddAllocations = &alloc, []int{alloc}
+	}
+	if body, changed := build.merge(current); len(changed) > 0 {
+		if _, err = a.updateServer(current.ID, "build", body); err != nil {
+			return err
+		}
+	}
+
+	if startup, changed := startupChanges(current, fields); changed {
+		if _, err = a.updateServer(current.ID, "startup", startup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplySpecPlan carries out the changes of a plan in order, skipping blocked
+// deletes, and stops at the first one that fails. Applied changes are
+// marked as such, so a failed run can be inspected.
+func (a *Application) ApplySpecPlan(plan *Plan) error {
+	if plan.state == nil {
+		return errors.New("the plan was not created by PlanSpec")
+	}
+
+	for _, c := range plan.Changes {
+		if c.Blocked || c.Applied {
+			continue
+		}
+		if err := c.apply(a, plan.state); err != nil {
+			return fmt.Errorf("%s %s %s: %w", c.Action, c.Kind, c.Name, err)
+		}
+		c.Applied = true
+	}
+
+	return nil
+}
@@ -0,0 +1,416 @@
+package crocgodyl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newPagedPanel serves the list endpoints of the application API the way
+// the panel does, returning only the first page unless per_page is raised.
+func newPagedPanel(t *testing.T, users int) *Application {
+	t.Helper()
+
+	page := func(r *http.Request, items []interface{}) map[string]interface{} {
+		perPage := 50
+		if v, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil {
+			perPage = v
+		}
+		if len(items) > perPage {
+			items = items[:perPage]
+		}
+
+		data := []interface{}{}
+		for _, item := range items {
+			data = append(data, map[string]interface{}{"attributes": item})
+		}
+		return map[string]interface{}{"data": data}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/api/application")
+
+		var items []interface{}
+		switch p {
+		case "/users":
+			for i := 1; i <= users; i++ {
+				items = append(items, map[string]interface{}{
+					"id":         i,
+					"username":   fmt.Sprintf("user%d", i),
+					"email":      fmt.Sprintf("user%d@example.com", i),
+					"first_name": "User",
+					"last_name":  strconv.Itoa(i),
+					"language":   "en",
+				})
+			}
+		case "/nodes":
+			items = append(items, map[string]interface{}{"id": 1, "name": "node1", "location_id": 1})
+		case "/locations", "/servers", "/nodes/1/allocations":
+		default:
+			t.Logf("unhandled request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":"NotFoundHttpException","status":"404","detail":"not found"}]}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(page(r, items))
+	}))
+	t.Cleanup(srv.Close)
+
+	app, err := NewApp(srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+func TestPlanSpecReadsAllPages(t *testing.T) {
+	app := newPagedPanel(t, 60)
+
+	spec := &Spec{Users: []*UserSpec{{
+		Username:  "user55",
+		Email:     "user55@example.com",
+		FirstName: "User",
+		LastName:  "55",
+		Language:  "en",
+	}}}
+
+	plan, err := app.PlanSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deletes := 0
+	for _, c := range plan.Changes {
+		if c.Kind != "user" {
+			continue
+		}
+		if c.Action != PlanDelete || c.Name == "user55" {
+			t.Fatalf("unexpected change %s %s %s", c.Action, c.Kind, c.Name)
+		}
+		deletes++
+	}
+	if deletes != 59 {
+		t.Fatalf("expected every other user to be deleted, got %d deletes", deletes)
+	}
+}
+
+func TestPlanSpecRequiresStartupForCreates(t *testing.T) {
+	app := newPagedPanel(t, 1)
+
+	spec := &Spec{Servers: []*ServerSpec{{
+		ExternalID: "srv1",
+		Name:       "Server",
+		User:       "user1",
+		Node:       "node1",
+		Allocation: "10.0.0.1:25565",
+		Egg:        1,
+		Limits:     ServerLimitsSpec{IO: 500},
+	}}}
+
+	if _, err := app.PlanSpec(spec); err == nil || !strings.Contains(err.Error(), "docker_image") {
+		t.Fatalf("expected docker_image to be required, got %v", err)
+	}
+
+	spec.Servers[0].DockerImage = "ghcr.io/pterodactyl/yolks:java_17"
+	spec.Servers[0].Startup = "java -jar server.jar"
+	plan, err := app.PlanSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != PlanCreate {
+		t.Fatalf("expected a single create, got %s", plan)
+	}
+}
+
+// seedPanel fills the fake panel with a location "eu", a node "node1" with
+// allocations on ports 25565 and 25570, a user "alice" and a server "srv1".
+func seedPanel(f *fakeApp) {
+	f.locations[1] = &Location{ID: 1, Short: "eu", Long: "Europe"}
+	f.nodes[2] = &Node{
+		ID: 2, Name: "node1", LocationID: 1, FQDN: "node1.example.com", Scheme: "https",
+		Memory: 1024, Disk: 10240, DaemonBase: "/var/lib/pterodactyl/volumes",
+		DaemonSftp: 2022, DaemonListen: 8080, UploadSize: 100,
+	}
+	f.allocations[2] = []*Allocation{
+		{ID: 3, IP: "10.0.0.1", Port: 25565, Assigned: true},
+		{ID: 4, IP: "10.0.0.1", Port: 25570},
+	}
+	f.users[5] = &User{ID: 5, Username: "alice", Email: "alice@example.com", FirstName: "Alice", LastName: "A", Language: "en"}
+	f.servers[6] = &AppServer{
+		ID: 6, ExternalID: "srv1", Name: "Survival", User: 5, Node: 2, Allocation: 3, Egg: 1,
+		Limits: Limits{Memory: 1024, Disk: 2048, IO: 500},
+	}
+	f.nextID = 100
+}
+
+// seedSpec matches the panel filled in by seedPanel.
+func seedSpec() *Spec {
+	return &Spec{
+		Locations: []*LocationSpec{{Short: "eu", Long: "Europe"}},
+		Nodes: []*NodeSpec{{
+			Name: "node1", Location: "eu", FQDN: "node1.example.com",
+			Memory: GiB, Disk: 10 * GiB,
+			Allocations: []*AllocationSpec{{IP: "10.0.0.1", Ports: []string{"25565", "25570"}}},
+		}},
+		Users: []*UserSpec{{Username: "alice", Email: "alice@example.com", FirstName: "Alice", LastName: "A"}},
+		Servers: []*ServerSpec{{
+			ExternalID: "srv1", Name: "Survival", User: "alice", Node: "node1", Allocation: "10.0.0.1:25565", Egg: 1,
+			Limits: ServerLimitsSpec{Memory: GiB, Disk: 2 * GiB, IO: 500},
+		}},
+	}
+}
+
+// planSummary lists the changes of a plan as "action kind name".
+func planSummary(plan *Plan) []string {
+	var changes []string
+	for _, c := range plan.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Name))
+	}
+
+	return changes
+}
+
+func TestPlanSpecUnchanged(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+
+	plan, err := f.app.PlanSpec(seedSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() || len(plan.Changes) != 0 {
+		t.Fatalf("expected no changes, got\n%s", plan)
+	}
+}
+
+func TestPlanSpecFieldChanges(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+
+	spec := seedSpec()
+	spec.Locations[0].Long = "Europe West"
+	spec.Nodes[0].Memory = 2 * GiB
+	spec.Users[0].Email = "alice@example.org"
+	spec.Servers[0].Limits.Memory = 4 * GiB
+
+	plan, err := f.app.PlanSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]FieldChange{
+		"location eu": {{Field: "long", Old: "Europe", New: "Europe West"}},
+		"node node1":  {{Field: "memory", Old: "1024", New: "2048"}},
+		"user alice":  {{Field: "email", Old: "alice@example.com", New: "alice@example.org"}},
+		"server srv1": {{Field: "limits.memory", Old: "1024", New: "4096"}},
+	}
+	if len(plan.Changes) != len(want) {
+		t.Fatalf("unexpected changes\n%s", plan)
+	}
+	for _, c := range plan.Changes {
+		fields, ok := want[c.Kind+" "+c.Name]
+		if !ok || c.Action != PlanUpdate || fmt.Sprint(c.Fields) != fmt.Sprint(fields) {
+			t.Fatalf("unexpected change %s %s %s %v", c.Action, c.Kind, c.Name, c.Fields)
+		}
+	}
+
+	if err = f.app.ApplySpecPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.takeWrites(), ", "); got != "PATCH /locations/1, PATCH /nodes/2, PATCH /users/5, PATCH /servers/6/build" {
+		t.Fatalf("unexpected requests %s", got)
+	}
+	if f.servers[6].Limits.Memory != 4096 || f.users[5].Email != "alice@example.org" || f.nodes[2].Memory != 2048 {
+		t.Fatal("the changes were not applied")
+	}
+
+	if plan, err = f.app.PlanSpec(spec); err != nil || len(plan.Changes) != 0 {
+		t.Fatalf("expected no changes after applying, got %v\n%s", err, plan)
+	}
+}
+
+// replacementSpec replaces everything seedPanel creates.
+func replacementSpec() *Spec {
+	return &Spec{
+		Locations: []*LocationSpec{{Short: "us", Long: "United States"}},
+		Nodes: []*NodeSpec{{
+			Name: "node2", Location: "us", FQDN: "node2.example.com",
+			Allocations: []*AllocationSpec{{IP: "10.0.0.2", Ports: []string{"25565-25567"}}},
+		}},
+		Users: []*UserSpec{{Username: "bob", Email: "bob@example.com", FirstName: "Bob", LastName: "B"}},
+		Servers: []*ServerSpec{{
+			ExternalID: "srv2", Name: "Creative", User: "bob", Node: "node2", Allocation: "10.0.0.2:25566", Egg: 1,
+			DockerImage: "ghcr.io/pterodactyl/yolks:java_17", Startup: "java -jar server.jar",
+			Limits: ServerLimitsSpec{IO: 500},
+		}},
+	}
+}
+
+func TestApplySpecPlanOrder(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+
+	plan, err := f.app.PlanSpec(replacementSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The allocations of node1 go away with the node.
+	want := []string{
+		"create location us",
+		"create node node2",
+		"create allocation node2 10.0.0.2",
+		"create user bob",
+		"create server srv2",
+		"delete server srv1",
+		"delete user alice",
+		"delete node node1",
+		"delete location eu",
+	}
+	if got := planSummary(plan); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected plan\n%s", strings.Join(got, "\n"))
+	}
+
+	if err = f.app.ApplySpecPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	writes := f.takeWrites()
+	wantWrites := []string{
+		"POST /locations",
+		"POST /nodes",
+		"POST /nodes/102/allocations",
+		"POST /users",
+		"POST /servers",
+		"DELETE /servers/6",
+		"DELETE /users/5",
+		"DELETE /nodes/2",
+		"DELETE /locations/1",
+	}
+	if strings.Join(writes, "\n") != strings.Join(wantWrites, "\n") {
+		t.Fatalf("unexpected requests\n%s", strings.Join(writes, "\n"))
+	}
+
+	// The server refers to objects created earlier in the same run.
+	var server *AppServer
+	for _, s := range f.servers {
+		server = s
+	}
+	if len(f.servers) != 1 || server.User != f.users[server.User].ID || f.allocationNode(server.Allocation) != 102 {
+		t.Fatalf("unexpected server %+v", server)
+	}
+	for _, c := range plan.Changes {
+		if !c.Applied {
+			t.Fatalf("change %s %s %s was not marked as applied", c.Action, c.Kind, c.Name)
+		}
+	}
+}
+
+func TestApplySpecPlanProtect(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+
+	spec := replacementSpec()
+	spec.Protect = true
+	plan, err := f.app.PlanSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := 0
+	for _, c := range plan.Changes {
+		if c.Blocked != (c.Action == PlanDelete) {
+			t.Fatalf("unexpected change %s %s %s, blocked %v", c.Action, c.Kind, c.Name, c.Blocked)
+		}
+		if c.Blocked {
+			blocked++
+		}
+	}
+	if blocked != 4 || !strings.Contains(plan.String(), "- server srv1 (protected)") {
+		t.Fatalf("expected the deletes to be blocked\n%s", plan)
+	}
+
+	if err = f.app.ApplySpecPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range f.takeWrites() {
+		if strings.HasPrefix(w, "DELETE") {
+			t.Fatalf("a protected object was deleted: %s", w)
+		}
+	}
+	if f.servers[6] == nil || f.users[5] == nil || f.nodes[2] == nil || f.locations[1] == nil || len(f.allocations[2]) != 2 {
+		t.Fatal("a protected object is gone")
+	}
+
+	// Once everything else is applied, only blocked deletes are left.
+	if plan, err = f.app.PlanSpec(spec); err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() || len(plan.Changes) != 4 {
+		t.Fatalf("expected only the blocked deletes, got\n%s", plan)
+	}
+}
+
+func TestPlanSpecAllocations(t *testing.T) {
+	f := newFakeApp(t)
+	seedPanel(f)
+
+	spec := seedSpec()
+	spec.Servers = nil
+	spec.Nodes[0].Allocations = []*AllocationSpec{{IP: "10.0.0.1", Alias: "play.example.com", Ports: []string{"25565-25567"}}}
+
+	plan, err := f.app.PlanSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(planSummary(plan), "\n"); got != "create allocation node1 10.0.0.1\ndelete allocation node1 10.0.0.1:25570" {
+		t.Fatalf("unexpected plan\n%s", got)
+	}
+	want := []FieldChange{{Field: "ports", New: "25566,25567"}, {Field: "alias", New: "play.example.com"}}
+	if fields := plan.Changes[0].Fields; fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+
+	if err = f.app.ApplySpecPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	var ports []string
+	for _, a := range f.allocations[2] {
+		ports = append(ports, strconv.Itoa(int(a.Port)))
+	}
+	if strings.Join(ports, ",") != "25565,25566,25567" {
+		t.Fatalf("unexpected allocations %s", ports)
+	}
+
+	if plan, err = f.app.PlanSpec(spec); err != nil || len(plan.Changes) != 0 {
+		t.Fatalf("expected no changes after applying, got %v\n%s", err, plan)
+	}
+}
+
+func TestPlanSpecListQuery(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.String())
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	app, err := NewApp(srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.GetLocations()
+	app.GetUsers()
+	app.GetServers()
+	app.getUsers(allPages)
+
+	want := "/api/application/locations /api/application/users /api/application/servers /api/application/users?per_page=10000"
+	if got := strings.Join(queries, " "); got != want {
+		t.Fatalf("unexpected requests %s", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -39,7 +40,11 @@ func (u *User) UpdateDescriptor() *UpdateUserDescriptor {
 }
 
 func (a *Application) GetUsers() ([]*User, error) {
-	req := a.newRequest("GET", "/users", nil)
+	return a.getUsers(nil)
+}
+
+func (a *Application) getUsers(query url.Values) ([]*User, error) {
+	req := a.newRequest("GET", withQuery("/users", query), nil)
 	res, err := a.Http.Do(req)
 	if err != nil {
 		return nil, err
@@ -160,6 +165,10 @@ type UpdateUserDescriptor struct {
 }
 
 func (a *Application) UpdateUser(id int, fields UpdateUserDescriptor) (*User, error) {
+	return a.updateUser(id, fields)
+}
+
+func (a *Application) updateUser(id int, fields interface{}) (*User, error) {
 	data, _ := json.Marshal(fields)
 	body := bytes.Buffer{}
 	body.Write(data)
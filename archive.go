@@ -0,0 +1,370 @@
+package crocgodyl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	ArchiveZip   ArchiveFormat = "zip"
+)
+
+func ArchiveFormatOf(name string) (ArchiveFormat, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz, true
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip, true
+	default:
+		return "", false
+	}
+}
+
+// safeJoin joins name onto dest, refusing absolute names and names that
+// would escape dest through "..".
+func safeJoin(dest, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+
+	target := filepath.Join(dest, name)
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q escapes the destination", name)
+	}
+
+	return target, nil
+}
+
+// ExtractArchive extracts the tar.gz or zip archive at src into dest. Entries
+// escaping dest are rejected, links and special files are skipped.
+func ExtractArchive(src, dest string) error {
+	format, ok := ArchiveFormatOf(src)
+	if !ok {
+		return fmt.Errorf("unsupported archive %s", filepath.Base(src))
+	}
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+
+	switch format {
+	case ArchiveZip:
+		return extractZip(src, dest)
+	default:
+		file, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return extractTarGz(file, dest)
+	}
+}
+
+func extractTarGz(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err = writeExtracted(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZip(src, dest string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		target, err := safeJoin(dest, f.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err = os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+
+			err = writeExtracted(target, rc, mode.Perm())
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeExtracted(target string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if perm == 0 {
+		perm = 0o644
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+type ArchiveEntry struct {
+	Name           string      `json:"name"`
+	Size           int64       `json:"size"`
+	CompressedSize int64       `json:"compressed_size,omitempty"`
+	Mode           os.FileMode `json:"mode"`
+	Link           string      `json:"link,omitempty"`
+	Problem        string      `json:"problem,omitempty"`
+
+	hardLink bool
+}
+
+type InspectOptions struct {
+	MaxTotalSize int64
+	MaxRatio     float64
+	MaxEntries   int
+}
+
+type ArchiveReport struct {
+	Format      ArchiveFormat   `json:"format"`
+	ArchiveSize int64           `json:"archive_size"`
+	TotalSize   int64           `json:"total_size"`
+	Entries     []*ArchiveEntry `json:"entries"`
+	Problems    []string        `json:"problems,omitempty"`
+}
+
+// Safe reports whether no entry or limit was flagged.
+func (r *ArchiveReport) Safe() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ArchiveReport) Ratio() float64 {
+	if r.ArchiveSize == 0 {
+		return 0
+	}
+
+	return float64(r.TotalSize) / float64(r.ArchiveSize)
+}
+
+func (r *ArchiveReport) flag(entry *ArchiveEntry, problem string) {
+	if entry != nil {
+		entry.Problem = problem
+		problem = entry.Name + ": " + problem
+	}
+	r.Problems = append(r.Problems, problem)
+}
+
+// check flags entries that would escape the extraction directory, links
+// pointing outside of it and duplicates.
+func (r *ArchiveReport) check(entry *ArchiveEntry, seen map[string]struct{}) {
+	const root = "/archive"
+
+	target, err := safeJoin(root, entry.Name)
+	switch {
+	case err != nil:
+		r.flag(entry, "path escapes the extraction directory")
+		return
+	case entry.Link != "":
+		// Hard links are relative to the archive root, symlinks to the
+		// directory containing them.
+		base := filepath.Dir(target)
+		if entry.hardLink {
+			base = root
+		}
+
+		link := entry.Link
+		if !filepath.IsAbs(filepath.FromSlash(link)) {
+			link = filepath.Join(base, filepath.FromSlash(link))
+		}
+		if rel, err := filepath.Rel(root, link); err != nil || filepath.IsAbs(entry.Link) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			r.flag(entry, "link points outside of the extraction directory")
+			return
+		}
+	}
+
+	if _, ok := seen[target]; ok {
+		r.flag(entry, "duplicate entry")
+		return
+	}
+	seen[target] = struct{}{}
+}
+
+// InspectArchive lists the entries of a local tar.gz or zip archive without
+// extracting it, flagging entries that escape the extraction directory and
+// archives whose uncompressed size or compression ratio look like a zip bomb.
+// Defaults allow 10 GiB, a ratio of 100 and 100000 entries. Reading stops
+// early once a limit is exceeded.
+func InspectArchive(src string, opts InspectOptions) (*ArchiveReport, error) {
+	if opts.MaxTotalSize <= 0 {
+		opts.MaxTotalSize = 10 << 30
+	}
+	if opts.MaxRatio <= 0 {
+		opts.MaxRatio = 100
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 100000
+	}
+
+	format, ok := ArchiveFormatOf(src)
+	if !ok {
+		return nil, fmt.Errorf("unsupported archive %s", filepath.Base(src))
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ArchiveReport{Format: format, ArchiveSize: info.Size(), Entries: []*ArchiveEntry{}}
+	seen := map[string]struct{}{}
+
+	add := func(entry *ArchiveEntry) bool {
+		report.Entries = append(report.Entries, entry)
+		report.TotalSize += entry.Size
+		report.check(entry, seen)
+
+		if entry.CompressedSize > 0 && float64(entry.Size)/float64(entry.CompressedSize) > opts.MaxRatio {
+			report.flag(entry, "suspicious compression ratio")
+		}
+
+		switch {
+		case len(report.Entries) > opts.MaxEntries:
+			report.flag(nil, fmt.Sprintf("archive has more than %d entries", opts.MaxEntries))
+		case report.TotalSize > opts.MaxTotalSize:
+			report.flag(nil, fmt.Sprintf("archive expands to more than %d bytes", opts.MaxTotalSize))
+		default:
+			return true
+		}
+		return false
+	}
+
+	if format == ArchiveZip {
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			entry := &ArchiveEntry{
+				Name:           f.Name,
+				Size:           int64(f.UncompressedSize64),
+				CompressedSize: int64(f.CompressedSize64),
+				Mode:           f.Mode(),
+			}
+			if entry.Mode&os.ModeSymlink != 0 {
+				if entry.Link, err = readZipLink(f); err != nil {
+					return nil, err
+				}
+			}
+			if !add(entry) {
+				break
+			}
+		}
+	} else {
+		file, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			entry := &ArchiveEntry{Name: hdr.Name, Size: hdr.Size, Mode: hdr.FileInfo().Mode()}
+			if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+				entry.Link, entry.hardLink = hdr.Linkname, hdr.Typeflag == tar.TypeLink
+			}
+			if !add(entry) {
+				break
+			}
+		}
+	}
+
+	if report.Safe() && report.Ratio() > opts.MaxRatio {
+		report.flag(nil, fmt.Sprintf("compression ratio of %.0f exceeds %.0f", report.Ratio(), opts.MaxRatio))
+	}
+
+	return report, nil
+}
+
+func readZipLink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	return string(target), err
+}
@@ -0,0 +1,144 @@
+package crocgodyl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	dest := filepath.Join("tmp", "dest")
+
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{name: "level.dat", want: filepath.Join(dest, "level.dat"), ok: true},
+		{name: "world/region/r.0.0.mca", want: filepath.Join(dest, "world", "region", "r.0.0.mca"), ok: true},
+		{name: "world/../level.dat", want: filepath.Join(dest, "level.dat"), ok: true},
+		{name: "./world/", want: filepath.Join(dest, "world"), ok: true},
+		{name: "..", ok: false},
+		{name: "../evil", ok: false},
+		{name: "world/../../evil", ok: false},
+		{name: "/etc/passwd", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, err := safeJoin(dest, tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%s: got %q, %v", tt.name, got, err)
+		}
+	}
+}
+
+// tarGzEntry is an entry written by writeTarGz, a symlink when link is set.
+type tarGzEntry struct {
+	name, link, data string
+}
+
+func writeTarGz(t *testing.T, name string, entries []tarGzEntry) {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.data))
+	}
+	tw.Close()
+	gz.Close()
+
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeTarGz(t, filepath.Join(dir, "world.tar.gz"), []tarGzEntry{
+		{name: "world/level.dat", data: "level"},
+		{name: "world/region/r.0.0.mca", data: "region"},
+		{name: "world/link", link: "/etc/passwd"},
+	})
+	writeZip(t, filepath.Join(dir, "plugins.zip"), map[string]string{
+		"plugins/a.jar":        "a",
+		"plugins/config/a.yml": "a: 1\n",
+		"plugins/config/":      "",
+	})
+
+	dest := filepath.Join(dir, "out")
+	for _, name := range []string{"world.tar.gz", "plugins.zip"} {
+		if err := ExtractArchive(filepath.Join(dir, name), dest); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"world/level.dat":        "level",
+		"world/region/r.0.0.mca": "region",
+		"plugins/a.jar":          "a",
+		"plugins/config/a.yml":   "a: 1\n",
+	} {
+		if b, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name))); err != nil || string(b) != want {
+			t.Errorf("%s: got %q, %v", name, b, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "world", "link")); !os.IsNotExist(err) {
+		t.Fatalf("expected the symlink to be skipped, got %v", err)
+	}
+
+	if err := ExtractArchive(filepath.Join(dir, "world.rar"), dest); err == nil {
+		t.Fatal("expected an unsupported archive to be rejected")
+	}
+}
+
+func TestExtractArchiveTraversal(t *testing.T) {
+	dir := t.TempDir()
+	writeTarGz(t, filepath.Join(dir, "evil.tar.gz"), []tarGzEntry{
+		{name: "world/level.dat", data: "level"},
+		{name: "world/../../evil", data: "evil"},
+	})
+	writeZip(t, filepath.Join(dir, "evil.zip"), map[string]string{"../evil": "evil"})
+
+	dest := filepath.Join(dir, "out")
+	for _, name := range []string{"evil.tar.gz", "evil.zip"} {
+		if err := ExtractArchive(filepath.Join(dir, name), dest); err == nil {
+			t.Fatalf("%s: expected the escaping entry to be rejected", name)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Fatalf("an entry was written outside of the destination: %v", err)
+	}
+}
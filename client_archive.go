@@ -0,0 +1,108 @@
+package crocgodyl
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// locateArchive finds the archive that appeared between two listings of the
+// same directory. It fails when none or several did, rather than guessing.
+func locateArchive(before, after []*File) (*File, error) {
+	existing := make(map[string]struct{}, len(before))
+	for _, f := range before {
+		existing[f.Name] = struct{}{}
+	}
+
+	var archive *File
+	for _, f := range after {
+		if _, ok := existing[f.Name]; ok || !f.IsFile {
+			continue
+		}
+		if _, ok := ArchiveFormatOf(f.Name); !ok {
+			continue
+		}
+		if archive != nil {
+			return nil, fmt.Errorf("several archives appeared (%s, %s), cannot tell which one was created", archive.Name, f.Name)
+		}
+		archive = f
+	}
+
+	if archive == nil {
+		return nil, errors.New("could not locate the created archive")
+	}
+
+	return archive, nil
+}
+
+// relativePath returns target relative to base, both being cleaned absolute
+// remote paths.
+func relativePath(base, target string) string {
+	split := func(p string) []string {
+		if p = strings.Trim(p, "/"); p == "" {
+			return nil
+		}
+		return strings.Split(p, "/")
+	}
+	from, to := split(base), split(target)
+
+	common := 0
+	for common < len(from) && common < len(to) && from[common] == to[common] {
+		common++
+	}
+
+	var parts []string
+	for range from[common:] {
+		parts = append(parts, "..")
+	}
+
+	return path.Join(append(parts, to[common:]...)...)
+}
+
+// ExtractServerArchive decompresses the archive into the target directory,
+// creating it first, and returns the entries of target that were added or
+// changed. The archive itself stays where it is.
+func (c *Client) ExtractServerArchive(identifier, archive, target string) ([]*File, error) {
+	archive, target = remotePath(archive), remotePath(target)
+
+	if target != "/" {
+		parent, base := path.Split(target)
+		if err := c.CreateServerFileFolder(identifier, CreateFolderDescriptor{Root: parent, Name: base}); err != nil {
+			return nil, err
+		}
+	}
+
+	before, err := c.GetServerFiles(identifier, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wings extracts into root and resolves file against it.
+	if err = c.DecompressServerFile(identifier, DecompressDescriptor{Root: target, File: relativePath(target, archive)}); err != nil {
+		return nil, err
+	}
+
+	after, err := c.GetServerFiles(identifier, target)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]*File, len(before))
+	for _, f := range before {
+		previous[f.Name] = f
+	}
+
+	var extracted []*File
+	for _, f := range after {
+		if path.Join(target, f.Name) == archive {
+			continue
+		}
+		if old, ok := previous[f.Name]; ok && sameRevision(old, f) {
+			continue
+		}
+		extracted = append(extracted, f)
+	}
+
+	return extracted, nil
+}
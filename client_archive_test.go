@@ -0,0 +1,124 @@
+package crocgodyl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompressServerFilesArchive(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("world/level.dat", []byte("level"), 0o644)
+
+	// An unrelated archive that looks newer than anything created below.
+	m.now = func() time.Time { return time.Now().Add(time.Hour) }
+	m.WriteFile("unrelated.zip", []byte("zip"), 0o644)
+	m.now = time.Now
+	m.WriteFile("old.tar.gz", []byte("old"), 0o644)
+
+	var listings, quiet int32
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/files/list"):
+				atomic.AddInt32(&listings, 1)
+			case strings.HasSuffix(r.URL.Path, "/files/compress") && atomic.LoadInt32(&quiet) == 1:
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	archive, err := c.CompressServerFilesArchive("abc", CompressDescriptor{Root: "/", Files: []string{"world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Stat(archive.Name); err != nil {
+		t.Fatalf("unexpected archive %q: %v", archive.Name, err)
+	}
+	if n := atomic.LoadInt32(&listings); n != 1 {
+		t.Fatalf("expected only the listing before compressing, got %d", n)
+	}
+
+	atomic.StoreInt32(&quiet, 1)
+	located, err := c.CompressServerFilesArchive("abc", CompressDescriptor{Root: "/", Files: []string{"world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch located.Name {
+	case archive.Name, "old.tar.gz", "unrelated.zip":
+		t.Fatalf("located the wrong archive %q", located.Name)
+	}
+	if _, err = m.Stat(located.Name); err != nil {
+		t.Fatalf("unexpected archive %q: %v", located.Name, err)
+	}
+}
+
+func TestLocateArchive(t *testing.T) {
+	old := &File{Name: "old.tar.gz", IsFile: true}
+	created := &File{Name: "archive-1.tar.gz", IsFile: true}
+	other := &File{Name: "other.zip", IsFile: true}
+	notes := &File{Name: "notes.txt", IsFile: true}
+
+	if f, err := locateArchive([]*File{old}, []*File{old, notes, created}); err != nil || f != created {
+		t.Fatalf("expected the created archive, got %v, %v", f, err)
+	}
+	if _, err := locateArchive([]*File{old}, []*File{old, created, other}); err == nil {
+		t.Fatal("expected an error when several archives appeared")
+	}
+	if _, err := locateArchive([]*File{old}, []*File{old}); err == nil {
+		t.Fatal("expected an error when no archive appeared")
+	}
+}
+
+func TestExtractServerArchiveLeavesArchive(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("world/level.dat", []byte("level"), 0o644)
+	m.WriteFile("world/region/r.0.0.mca", []byte("region"), 0o644)
+	c := newTestPanel(t, m)
+
+	archive, err := c.CompressServerFilesArchive("abc", CompressDescriptor{Root: "/", Files: []string{"world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Rename(archive.Name, "backups/"+archive.Name); err != nil {
+		t.Fatal(err)
+	}
+	before := m.Files()
+
+	extracted, err := c.ExtractServerArchive("abc", "/backups/"+archive.Name, "/restore/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extracted) != 1 || extracted[0].Name != "world" {
+		t.Fatalf("unexpected extracted entries %v", extracted)
+	}
+
+	b, err := m.ReadFile("restore/latest/world/region/r.0.0.mca")
+	if err != nil || string(b) != "region" {
+		t.Fatalf("unexpected contents %q, %v", b, err)
+	}
+	for _, name := range before {
+		if _, err = m.Stat(name); err != nil {
+			t.Fatalf("%s was moved: %v", name, err)
+		}
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	for _, tt := range []struct{ base, target, want string }{
+		{"/", "/a/b.zip", "a/b.zip"},
+		{"/a", "/a/b.zip", "b.zip"},
+		{"/a/c", "/a/b.zip", "../b.zip"},
+		{"/x/y", "/a/b.zip", "../../a/b.zip"},
+	} {
+		if got := relativePath(tt.base, tt.target); got != tt.want {
+			t.Errorf("relativePath(%q, %q) = %q, want %q", tt.base, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bulkBatchSize caps the number of files sent in a single request.
+const bulkBatchSize = 100
+
+// FileSelector picks files below a root directory. Include and Exclude are
+// MatchGlob patterns relative to the root; without Include every file is
+// selected. OlderThan keeps only entries last modified before that long
+// ago, and Directories lets directories be selected as well.
+type FileSelector struct {
+	Include     []string
+	Exclude     []string
+	OlderThan   time.Duration
+	Directories bool
+}
+
+func (s *FileSelector) matches(rel string, info fs.FileInfo, now time.Time) bool {
+	if info.IsDir() && !s.Directories {
+		return false
+	}
+	if len(s.Include) > 0 && !matchAny(s.Include, rel) {
+		return false
+	}
+	if s.OlderThan > 0 && info.ModTime().After(now.Add(-s.OlderThan)) {
+		return false
+	}
+
+	return true
+}
+
+type BulkFile struct {
+	Path       string     `json:"path"`
+	Dir        bool       `json:"dir,omitempty"`
+	Size       int64      `json:"size"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	Err        error      `json:"-"`
+}
+
+type BulkResult struct {
+	Root   string      `json:"root"`
+	DryRun bool        `json:"dry_run"`
+	Files  []*BulkFile `json:"files"`
+}
+
+func (r *BulkResult) String() string {
+	sb := &strings.Builder{}
+	for _, f := range r.Files {
+		name := path.Join(r.Root, f.Path)
+		if f.Dir {
+			name += "/"
+		}
+
+		sb.WriteString(name)
+		if f.Err != nil {
+			sb.WriteString(": " + f.Err.Error())
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func (r *BulkResult) Err() error {
+	var errs []error
+	for _, f := range r.Files {
+		if f.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path.Join(r.Root, f.Path), f.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// byDir groups the selected files by their parent directory, relative to
+// the root, in batches of at most bulkBatchSize.
+func (r *BulkResult) byDir() map[string][][]*BulkFile {
+	batches := map[string][][]*BulkFile{}
+	for _, f := range r.Files {
+		dir := path.Dir(f.Path)
+		last := len(batches[dir]) - 1
+		if last < 0 || len(batches[dir][last]) == bulkBatchSize {
+			batches[dir] = append(batches[dir], nil)
+			last++
+		}
+		batches[dir][last] = append(batches[dir][last], f)
+	}
+
+	return batches
+}
+
+// selectServerFiles walks root and returns the entries picked by sel. When
+// descend is false the contents of selected directories are not visited,
+// since operations such as deleting cover them already.
+func (c *Client) selectServerFiles(ctx context.Context, identifier, root string, sel FileSelector, descend bool) (*BulkResult, error) {
+	result := &BulkResult{Root: remotePath(root), Files: []*BulkFile{}}
+	now := time.Now()
+
+	err := walkServerDir(ctx, c.ServerFS(identifier), result.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+
+		if matchAny(sel.Exclude, p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !sel.matches(p, info, now) {
+			return nil
+		}
+
+		f := &BulkFile{Path: p, Dir: d.IsDir(), Size: info.Size()}
+		if file, ok := info.Sys().(*File); ok {
+			f.ModifiedAt = file.ModifiedAt
+		}
+		result.Files = append(result.Files, f)
+
+		if d.IsDir() && !descend {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].Path < result.Files[j].Path
+	})
+
+	return result, nil
+}
+
+// SelectServerFiles lists the entries below root picked by sel, which is
+// what the bulk operations act on.
+func (c *Client) SelectServerFiles(ctx context.Context, identifier, root string, sel FileSelector) (*BulkResult, error) {
+	result, err := c.selectServerFiles(ctx, identifier, root, sel, true)
+	if result != nil {
+		result.DryRun = true
+	}
+
+	return result, err
+}
+
+// ChmodServerFilesMatching changes the mode of every entry below root picked
+// by sel, with one request per directory. With dryRun set the selection is
+// only returned. Errors are recorded per file; see BulkResult.Err.
+func (c *Client) ChmodServerFilesMatching(ctx context.Context, identifier, root string, sel FileSelector, mode fs.FileMode, dryRun bool) (*BulkResult, error) {
+	result, err := c.selectServerFiles(ctx, identifier, root, sel, true)
+	if err != nil {
+		return nil, err
+	}
+	if result.DryRun = dryRun; dryRun {
+		return result, nil
+	}
+
+	for dir, batches := range result.byDir() {
+		for _, batch := range batches {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+
+			files := ChmodDescriptor{Root: path.Join(result.Root, dir)}
+			for _, f := range batch {
+				files.Files = append(files.Files, struct {
+					File string `json:"file"`
+					Mode uint32 `json:"mode"`
+				}{File: path.Base(f.Path), Mode: chmodMode(mode)})
+			}
+
+			err := c.ChmodServerFiles(identifier, files)
+			for _, f := range batch {
+				f.Err = err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteServerFilesMatching deletes every entry below root picked by sel,
+// with one request per directory. Selected directories are deleted with
+// their contents. With dryRun set the selection is only returned.
+func (c *Client) DeleteServerFilesMatching(ctx context.Context, identifier, root string, sel FileSelector, dryRun bool) (*BulkResult, error) {
+	result, err := c.selectServerFiles(ctx, identifier, root, sel, false)
+	if err != nil {
+		return nil, err
+	}
+	if result.DryRun = dryRun; dryRun {
+		return result, nil
+	}
+
+	for dir, batches := range result.byDir() {
+		for _, batch := range batches {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+
+			files := DeleteFilesDescriptor{Root: path.Join(result.Root, dir)}
+			for _, f := range batch {
+				files.Files = append(files.Files, path.Base(f.Path))
+			}
+
+			err := c.DeleteServerFiles(identifier, files)
+			for _, f := range batch {
+				f.Err = err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// CopyServerTree copies the entries of src picked by sel into dst, keeping
+// their relative paths. Wings can only copy single files next to the
+// original, so the selection is compressed into an archive that is
+// extracted into dst and deleted afterwards.
+func (c *Client) CopyServerTree(ctx context.Context, identifier, src, dst string, sel FileSelector, dryRun bool) (result *BulkResult, err error) {
+	src, dst = remotePath(src), remotePath(dst)
+	if dst == src || strings.HasPrefix(dst, strings.TrimSuffix(src, "/")+"/") {
+		return nil, errors.New("cannot copy a directory into itself")
+	}
+
+	result, err = c.selectServerFiles(ctx, identifier, src, sel, false)
+	if err != nil {
+		return nil, err
+	}
+	if result.DryRun = dryRun; dryRun || len(result.Files) == 0 {
+		return result, nil
+	}
+
+	files := CompressDescriptor{Root: src}
+	for _, f := range result.Files {
+		files.Files = append(files.Files, f.Path)
+	}
+
+	archive, err := c.CompressServerFilesArchive(identifier, files)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		derr := c.DeleteServerFiles(identifier, DeleteFilesDescriptor{Root: src, Files: []string{archive.Name}})
+		if err == nil {
+			err = derr
+		}
+	}()
+
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if _, err = c.ExtractServerArchive(identifier, path.Join(src, archive.Name), dst); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
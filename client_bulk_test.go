@@ -0,0 +1,172 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordBodies records the decoded bodies of requests to the file endpoint
+// ending in suffix.
+func recordBodies[T any](suffix string, bodies *[]T) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, suffix) {
+				data, _ := io.ReadAll(r.Body)
+				r.Body = io.NopCloser(bytes.NewReader(data))
+
+				var body T
+				json.Unmarshal(data, &body)
+				mu.Lock()
+				*bodies = append(*bodies, body)
+				mu.Unlock()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestDeleteServerFilesMatchingBatches(t *testing.T) {
+	m := NewMemoryFS()
+	for i := 0; i < 150; i++ {
+		m.WriteFile(fmt.Sprintf("logs/%03d.log", i), []byte("log"), 0o644)
+	}
+	m.WriteFile("logs/keep.log", []byte("log"), 0o644)
+	m.WriteFile("logs/latest.txt", []byte("log"), 0o644)
+	m.WriteFile("crash.log", []byte("log"), 0o644)
+	m.WriteFile("cache/a.log", []byte("log"), 0o644)
+	m.WriteFile("cache/b.log", []byte("log"), 0o644)
+
+	var requests []DeleteFilesDescriptor
+	c := newTestPanelWith(t, m, recordBodies("/files/delete", &requests))
+
+	sel := FileSelector{Include: []string{"*.log", "cache"}, Exclude: []string{"keep.log"}, Directories: true}
+	result, err := c.DeleteServerFilesMatching(context.Background(), "abc", "/", sel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = result.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache directory is deleted as a whole, without its contents being
+	// listed separately.
+	if len(result.Files) != 152 || result.DryRun {
+		t.Fatalf("unexpected selection of %d files", len(result.Files))
+	}
+
+	got := map[string][]int{}
+	for _, r := range requests {
+		got[r.Root] = append(got[r.Root], len(r.Files))
+	}
+	if len(requests) != 3 || fmt.Sprint(got["/logs"]) != "[100 50]" || fmt.Sprint(got["/"]) != "[2]" {
+		t.Fatalf("unexpected requests %v", got)
+	}
+
+	if files := m.Files(); strings.Join(files, ",") != "logs/keep.log,logs/latest.txt" {
+		t.Fatalf("unexpected files left %q", files)
+	}
+}
+
+func TestDeleteServerFilesMatchingDryRun(t *testing.T) {
+	m := NewMemoryFS()
+	m.now = func() time.Time { return time.Now().Add(-48 * time.Hour) }
+	m.WriteFile("backups/old.tar.gz", []byte("old"), 0o644)
+	m.now = time.Now
+	m.WriteFile("backups/new.tar.gz", []byte("new"), 0o644)
+
+	var requests []DeleteFilesDescriptor
+	c := newTestPanelWith(t, m, recordBodies("/files/delete", &requests))
+
+	sel := FileSelector{Include: []string{"*.tar.gz"}, OlderThan: 24 * time.Hour}
+	result, err := c.DeleteServerFilesMatching(context.Background(), "abc", "backups", sel, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.DryRun || len(result.Files) != 1 || result.Files[0].Path != "old.tar.gz" {
+		t.Fatalf("unexpected selection %+v", result)
+	}
+	if result.String() != "/backups/old.tar.gz\n" {
+		t.Fatalf("unexpected listing %q", result.String())
+	}
+	if len(requests) != 0 || len(m.Files()) != 2 {
+		t.Fatalf("a dry run deleted files: %v", requests)
+	}
+}
+
+func TestChmodServerFilesMatching(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("start.sh", []byte("#!/bin/sh\n"), 0o644)
+	m.WriteFile("scripts/backup.sh", []byte("#!/bin/sh\n"), 0o644)
+	m.WriteFile("scripts/notes.txt", []byte("notes"), 0o644)
+
+	var requests []ChmodDescriptor
+	c := newTestPanelWith(t, m, recordBodies("/files/chmod", &requests))
+
+	sel := FileSelector{Include: []string{"*.sh"}}
+	result, err := c.ChmodServerFilesMatching(context.Background(), "abc", "/", sel, 0o755, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 2 || len(requests) != 0 {
+		t.Fatalf("unexpected dry run %+v, %d requests", result, len(requests))
+	}
+
+	if result, err = c.ChmodServerFilesMatching(context.Background(), "abc", "/", sel, 0o755, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = result.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected one request per directory, got %+v", requests)
+	}
+
+	for name, want := range map[string]string{"start.sh": "-rwxr-xr-x", "scripts/backup.sh": "-rwxr-xr-x", "scripts/notes.txt": "-rw-r--r--"} {
+		if info, _ := m.Stat(name); info.Mode().String() != want {
+			t.Errorf("%s: unexpected mode %v", name, info.Mode())
+		}
+	}
+}
+
+func TestCopyServerTree(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("plugins/a.jar", []byte("a"), 0o644)
+	m.WriteFile("plugins/config/a.yml", []byte("a: 1\n"), 0o644)
+	m.WriteFile("plugins/b.jar.old", []byte("old"), 0o644)
+	c := newTestPanel(t, m)
+
+	if _, err := c.CopyServerTree(context.Background(), "abc", "plugins", "plugins/copy", FileSelector{}, false); err == nil {
+		t.Fatal("expected copying a directory into itself to fail")
+	}
+
+	sel := FileSelector{Exclude: []string{"*.old"}, Directories: true}
+	result, err := c.CopyServerTree(context.Background(), "abc", "plugins", "backup/plugins", sel, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || result.String() != "/plugins/a.jar\n/plugins/config/\n" {
+		t.Fatalf("unexpected dry run %q", result.String())
+	}
+	if len(m.Files()) != 3 {
+		t.Fatalf("a dry run changed files: %q", m.Files())
+	}
+
+	if _, err = c.CopyServerTree(context.Background(), "abc", "plugins", "backup/plugins", sel, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "backup/plugins/a.jar,backup/plugins/config/a.yml,plugins/a.jar,plugins/b.jar.old,plugins/config/a.yml"
+	if files := strings.Join(m.Files(), ","); files != want {
+		t.Fatalf("unexpected files %s", files)
+	}
+}
@@ -0,0 +1,255 @@
+package crocgodyl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	EventAuth             = "auth"
+	EventAuthSuccess      = "auth success"
+	EventStatus           = "status"
+	EventConsoleOutput    = "console output"
+	EventStats            = "stats"
+	EventTokenExpiring    = "token expiring"
+	EventTokenExpired     = "token expired"
+	EventInstallOutput    = "install output"
+	EventInstallStarted   = "install started"
+	EventInstallCompleted = "install completed"
+	EventDaemonMessage    = "daemon message"
+	EventDaemonError      = "daemon error"
+	EventJWTError         = "jwt error"
+	EventSendLogs         = "send logs"
+	EventSendStats        = "send stats"
+	EventSendCommand      = "send command"
+	EventSetState         = "set state"
+)
+
+var ErrConsoleClosed = errors.New("console connection is closed")
+
+type ConsoleEvent struct {
+	Event string   `json:"event"`
+	Args  []string `json:"args,omitempty"`
+}
+
+type Console struct {
+	client     *Client
+	identifier string
+	conn       *websocket.Conn
+
+	writeMu sync.Mutex
+	subMu   sync.Mutex
+	subs    map[*subscription]struct{}
+	drained bool
+	dropped uint64
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+type subscription struct {
+	ch chan *ConsoleEvent
+}
+
+func (c *Client) OpenConsole(ctx context.Context, identifier string) (*Console, error) {
+	auth, err := c.GetServerWebSocket(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Origin", c.PanelURL)
+	header.Set("User-Agent", "Crocgodyl v"+Version)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, auth.Socket, header)
+	if err != nil {
+		return nil, err
+	}
+
+	con := &Console{
+		client:     c,
+		identifier: identifier,
+		conn:       conn,
+		subs:       map[*subscription]struct{}{},
+		done:       make(chan struct{}),
+	}
+
+	if err = con.Send(EventAuth, auth.Token); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go con.read()
+	return con, nil
+}
+
+func (c *Console) Identifier() string {
+	return c.identifier
+}
+
+func (c *Console) Client() *Client {
+	return c.client
+}
+
+func (c *Console) Send(event string, args ...string) error {
+	select {
+	case <-c.done:
+		return ErrConsoleClosed
+	default:
+	}
+
+	data, _ := json.Marshal(ConsoleEvent{Event: event, Args: args})
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Console) SendCommand(command string) error {
+	return c.Send(EventSendCommand, command)
+}
+
+func (c *Console) SetState(signal PowerSignal) error {
+	forget := c.client.noteSignal(c.identifier, signal)
+	if err := c.Send(EventSetState, string(signal)); err != nil {
+		forget()
+		return err
+	}
+
+	return nil
+}
+
+func (c *Console) RequestLogs() error {
+	return c.Send(EventSendLogs)
+}
+
+func (c *Console) RequestStats() error {
+	return c.Send(EventSendStats)
+}
+
+// Subscribe returns a channel receiving every event read from the socket
+// after the call, and a function that cancels the subscription. Channels of
+// active subscriptions are closed once the console shuts down. Events are
+// dropped for a subscriber that falls more than 64 events behind, so that
+// it cannot hold up the others.
+func (c *Console) Subscribe() (<-chan *ConsoleEvent, func()) {
+	sub := &subscription{ch: make(chan *ConsoleEvent, 64)}
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if c.drained {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	c.subs[sub] = struct{}{}
+
+	return sub.ch, func() {
+		c.subMu.Lock()
+		delete(c.subs, sub)
+		c.subMu.Unlock()
+	}
+}
+
+// Dropped returns how many events were dropped for slow subscribers.
+func (c *Console) Dropped() uint64 {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	return c.dropped
+}
+
+func (c *Console) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Console) Err() error {
+	<-c.done
+	return c.err
+}
+
+func (c *Console) Close() error {
+	c.shutdown(ErrConsoleClosed)
+	return nil
+}
+
+func (c *Console) shutdown(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *Console) read() {
+	defer func() {
+		c.subMu.Lock()
+		c.drained = true
+		for sub := range c.subs {
+			delete(c.subs, sub)
+			close(sub.ch)
+		}
+		c.subMu.Unlock()
+	}()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+
+		var ev ConsoleEvent
+		if err = json.Unmarshal(data, &ev); err != nil {
+			continue
+		}
+
+		switch ev.Event {
+		case EventTokenExpiring:
+			go c.reauth()
+		case EventTokenExpired:
+			c.shutdown(errors.New("console token expired"))
+			return
+		case EventJWTError:
+			msg := "console authentication failed"
+			if len(ev.Args) > 0 {
+				msg += ": " + ev.Args[0]
+			}
+			c.shutdown(errors.New(msg))
+			return
+		}
+
+		c.publish(&ev)
+	}
+}
+
+// publish hands the event to every subscriber without blocking the read
+// loop. Subscribers whose buffer is full miss the event.
+func (c *Console) publish(ev *ConsoleEvent) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	for sub := range c.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			c.dropped++
+		}
+	}
+}
+
+func (c *Console) reauth() {
+	auth, err := c.client.GetServerWebSocket(c.identifier)
+	if err != nil {
+		c.shutdown(err)
+		return
+	}
+
+	if err = c.Send(EventAuth, auth.Token); err != nil {
+		c.shutdown(err)
+	}
+}
@@ -0,0 +1,326 @@
+package crocgodyl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeWings serves the power, resources and websocket endpoints of a single
+// server named "abc", the way the panel and Wings would.
+type fakeWings struct {
+	client *Client
+
+	mu          sync.Mutex
+	state       string
+	installing  bool
+	status      string
+	noSocket    bool
+	signals     []string
+	conns       []*websocket.Conn
+	onSignal    func(signal string)
+	onConnect   func()
+	onMessage   func(ev ConsoleEvent)
+	onResources func()
+}
+
+func newFakeWings(t *testing.T, state string) *fakeWings {
+	t.Helper()
+
+	f := &fakeWings{state: state}
+	upgrader := websocket.Upgrader{}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		state, installing, status, noSocket := f.state, f.installing, f.status, f.noSocket
+		f.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/client/servers/abc/websocket":
+			if noSocket {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[{"code":"NotFoundHttpException","status":"404","detail":"not found"}]}`)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"token":  "token",
+				"socket": "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws",
+			}})
+
+		case "/api/client/servers/abc/resources":
+			json.NewEncoder(w).Encode(map[string]interface{}{"attributes": map[string]interface{}{
+				"current_state": state,
+			}})
+
+			f.mu.Lock()
+			onResources := f.onResources
+			f.mu.Unlock()
+			if onResources != nil {
+				onResources()
+			}
+
+		case "/api/client/servers/abc":
+			json.NewEncoder(w).Encode(map[string]interface{}{"attributes": map[string]interface{}{
+				"identifier":    "abc",
+				"status":        status,
+				"is_installing": installing,
+			}})
+
+		case "/api/client/servers/abc/power":
+			var body struct {
+				Signal string `json:"signal"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+
+			f.mu.Lock()
+			f.signals = append(f.signals, body.Signal)
+			onSignal := f.onSignal
+			f.mu.Unlock()
+
+			if onSignal != nil {
+				onSignal(body.Signal)
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case "/ws":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			// Registered right away, so that events emitted once the
+			// client is done dialing are not lost.
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			onConnect := f.onConnect
+			f.mu.Unlock()
+
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+			f.emit(EventAuthSuccess)
+
+			if onConnect != nil {
+				onConnect()
+			}
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+
+				f.mu.Lock()
+				onMessage := f.onMessage
+				f.mu.Unlock()
+
+				var ev ConsoleEvent
+				if onMessage != nil && json.Unmarshal(data, &ev) == nil {
+					onMessage(ev)
+				}
+			}
+
+		default:
+			t.Logf("unhandled request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(func() {
+		f.mu.Lock()
+		for _, conn := range f.conns {
+			conn.Close()
+		}
+		f.mu.Unlock()
+		srv.Close()
+	})
+
+	c, err := NewClient(srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.client = c
+
+	return f
+}
+
+// emit sends an event to every open console.
+func (f *fakeWings) emit(event string, args ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, conn := range f.conns {
+		conn.WriteJSON(ConsoleEvent{Event: event, Args: args})
+	}
+}
+
+// setState changes the state reported by the resources endpoint and emits
+// the matching status event.
+func (f *fakeWings) setState(state string) {
+	f.mu.Lock()
+	f.state = state
+	f.mu.Unlock()
+
+	f.emit(EventStatus, state)
+}
+
+func (f *fakeWings) sentSignals() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.signals...)
+}
+
+func TestConsoleSlowSubscriber(t *testing.T) {
+	f := newFakeWings(t, "running")
+	connected := make(chan struct{})
+	f.onConnect = func() { close(connected) }
+
+	con, err := f.client.OpenConsole(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	// Never read from, so its buffer fills up.
+	_, cancelSlow := con.Subscribe()
+	defer cancelSlow()
+	events, cancel := con.Subscribe()
+	defer cancel()
+
+	<-connected
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < 200; i++ {
+		f.emit(EventConsoleOutput, fmt.Sprint(i))
+
+	wait:
+		for {
+			select {
+			case ev := <-events:
+				if ev.Event != EventConsoleOutput {
+					continue
+				}
+				if len(ev.Args) == 0 || ev.Args[0] != fmt.Sprint(i) {
+					t.Fatalf("unexpected event %v", ev)
+				}
+				break wait
+			case <-timeout:
+				t.Fatalf("the slow subscriber held up the others after %d events", i)
+			}
+		}
+	}
+
+	if con.Dropped() == 0 {
+		t.Fatal("expected events to be dropped for the slow subscriber")
+	}
+}
+
+func TestConsoleTokenExpired(t *testing.T) {
+	f := newFakeWings(t, "running")
+	connected := make(chan struct{})
+	f.onConnect = func() { close(connected) }
+
+	con, err := f.client.OpenConsole(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := con.Subscribe()
+	defer cancel()
+
+	<-connected
+	f.emit(EventTokenExpired)
+
+	for range events {
+	}
+	if err = con.Err(); err == nil || errors.Is(err, ErrConsoleClosed) {
+		t.Fatalf("expected the token error, got %v", err)
+	}
+	if err = con.SendCommand("say hi"); !errors.Is(err, ErrConsoleClosed) {
+		t.Fatalf("expected ErrConsoleClosed, got %v", err)
+	}
+}
+
+func TestWaitForState(t *testing.T) {
+	f := newFakeWings(t, "starting")
+	f.onConnect = func() {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			f.setState("running")
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	st, err := f.client.WaitForState(ctx, "abc", StateRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != StateRunning {
+		t.Fatalf("expected running, got %s", st)
+	}
+}
+
+func TestWaitForStatePolls(t *testing.T) {
+	interval := StatePollInterval
+	StatePollInterval = 10 * time.Millisecond
+	defer func() { StatePollInterval = interval }()
+
+	f := newFakeWings(t, "starting")
+	f.noSocket = true
+	time.AfterFunc(50*time.Millisecond, func() { f.setState("running") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if st, err := f.client.WaitForState(ctx, "abc", StateRunning, StateOffline); err != nil || st != StateRunning {
+		t.Fatalf("expected running, got %s, %v", st, err)
+	}
+}
+
+func TestStopGracefullyKills(t *testing.T) {
+	f := newFakeWings(t, "running")
+	f.onSignal = func(signal string) {
+		// The server ignores stop and only goes down when killed.
+		if signal == string(PowerKill) {
+			go f.setState("offline")
+		}
+	}
+
+	killed, err := f.client.StopGracefully(context.Background(), "abc", 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !killed {
+		t.Fatal("expected the server to be killed")
+	}
+	if got := f.sentSignals(); strings.Join(got, ",") != "stop,kill" {
+		t.Fatalf("unexpected signals %q", got)
+	}
+}
+
+func TestSendPowerSignal(t *testing.T) {
+	f := newFakeWings(t, "offline")
+
+	if err := f.client.SendPowerSignal("abc", "reboot"); err == nil {
+		t.Fatal("expected an unknown signal to be rejected")
+	}
+	if err := f.client.SendPowerSignal("abc", PowerStart); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plain strings keep working with the untyped API.
+	signal := "restart"
+	if err := f.client.SetServerPowerState("abc", signal); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.sentSignals(); strings.Join(got, ",") != "start,restart" {
+		t.Fatalf("unexpected signals %q", got)
+	}
+}
@@ -0,0 +1,448 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrChecksumMismatch = errors.New("downloaded file does not match the expected checksum")
+
+// newChecksum parses a checksum in the form "algorithm:hex", for example
+// "sha256:9f86d0...". A bare hex digest is assumed to be sha256.
+func newChecksum(sum string) (hash.Hash, []byte, error) {
+	if sum == "" {
+		return nil, nil, nil
+	}
+
+	algo, digest, ok := strings.Cut(sum, ":")
+	if !ok {
+		algo, digest = "sha256", sum
+	}
+
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid checksum: %w", err)
+	}
+
+	var h hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+
+	if len(expected) != h.Size() {
+		return nil, nil, fmt.Errorf("invalid %s checksum length", algo)
+	}
+
+	return h, expected, nil
+}
+
+// ErrRemoteChanged is returned when a download cannot be resumed because the
+// remote file changed in the meantime and the data already received cannot
+// be discarded.
+var ErrRemoteChanged = errors.New("remote file changed during the download")
+
+// errRestartDownload is returned by fetch when the partial data was
+// discarded and the download has to start over with a fresh request.
+var errRestartDownload = errors.New("download has to start over")
+
+// ExecuteTo downloads the file to dest, or into dest if it is a directory.
+// Data is written to a ".part" file first, so an interrupted download is
+// resumed by the next call instead of starting over. A resume only keeps the
+// partial data when the server confirms the file is unchanged; otherwise the
+// download starts from the beginning. An existing file at dest is only
+// replaced when Overwrite is set.
+func (d *Downloader) ExecuteTo(ctx context.Context, dest string) error {
+	if dest == "" {
+		dest = d.Name
+	}
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, d.Name)
+	}
+	if info, err := os.Stat(dest); err == nil && !d.Overwrite {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", dest)
+		}
+		return errors.New("refusing to overwrite existing file path")
+	}
+
+	partial := dest + ".part"
+	// The validator of the remote file the partial data came from is kept
+	// next to it, for the If-Range header of the next attempt.
+	meta := partial + ".meta"
+
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+
+	rewind := func() error {
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		_, err := file.Seek(0, io.SeekStart)
+		return err
+	}
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	d.validator = ""
+	if b, err := os.ReadFile(meta); err == nil {
+		d.validator = string(b)
+	}
+	if offset > 0 && (d.validator == "" || (d.Size > 0 && offset > d.Size)) {
+		if err = rewind(); err != nil {
+			file.Close()
+			return err
+		}
+		offset = 0
+	}
+
+	h, expected, err := newChecksum(d.Checksum)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if h != nil && offset > 0 {
+		if _, err = io.Copy(h, io.NewSectionReader(file, 0, offset)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	sink := &downloadSink{w: file, rewind: rewind, remember: func(validator string) {
+		os.WriteFile(meta, []byte(validator), 0o644)
+	}}
+	_, err = d.download(ctx, sink, offset, h, expected)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if errors.Is(err, ErrChecksumMismatch) {
+			os.Remove(partial)
+			os.Remove(meta)
+		}
+		return err
+	}
+
+	os.Remove(meta)
+	return os.Rename(partial, dest)
+}
+
+// ExecuteWriter streams the file into w, resuming with Range requests when
+// the connection drops. It returns the number of bytes written. As written
+// data cannot be taken back, ErrRemoteChanged is returned when the file
+// changes between attempts.
+func (d *Downloader) ExecuteWriter(ctx context.Context, w io.Writer) (int64, error) {
+	h, expected, err := newChecksum(d.Checksum)
+	if err != nil {
+		return 0, err
+	}
+
+	d.validator = ""
+	return d.download(ctx, &downloadSink{w: w}, 0, h, expected)
+}
+
+// downloadSink receives the data of a download. A sink that can be rewound
+// lets a resumed download start over when the remote file changed.
+type downloadSink struct {
+	w        io.Writer
+	rewind   func() error
+	remember func(validator string)
+}
+
+func (d *Downloader) download(ctx context.Context, sink *downloadSink, offset int64, h hash.Hash, expected []byte) (int64, error) {
+	w := sink.w
+	if h != nil {
+		w = io.MultiWriter(w, h)
+	}
+
+	written := offset
+	restart := func() error {
+		if sink.rewind == nil {
+			return ErrRemoteChanged
+		}
+		if err := sink.rewind(); err != nil {
+			return err
+		}
+		if h != nil {
+			h.Reset()
+		}
+
+		written, offset = 0, 0
+		return nil
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if d.Size > 0 && written >= d.Size {
+			lastErr = nil
+			break
+		}
+
+		// Signed download URLs can only be used once.
+		if d.used && d.identifier != "" {
+			fresh, err := d.client.getDownloadUrl(d.identifier, d.Path)
+			if err != nil {
+				return written - offset, err
+			}
+			d.url = fresh
+		}
+		d.used = true
+
+		done, err := d.fetch(ctx, w, &written, restart, sink.remember)
+		if done {
+			lastErr = nil
+			break
+		}
+		if errors.Is(err, errRestartDownload) {
+			// Starting over does not count as a failed attempt.
+			attempt--
+			continue
+		}
+
+		lastErr = err
+		if ctx.Err() != nil {
+			return written - offset, ctx.Err()
+		}
+
+		var status *downloadStatusError
+		if errors.As(err, &status) {
+			switch status.code {
+			case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+				if d.identifier != "" {
+					continue
+				}
+			}
+			return written - offset, err
+		}
+		if errors.Is(err, ErrRemoteChanged) {
+			return written - offset, err
+		}
+	}
+
+	if lastErr != nil {
+		return written - offset, lastErr
+	}
+
+	if h != nil && !bytes.Equal(h.Sum(nil), expected) {
+		return written - offset, ErrChecksumMismatch
+	}
+
+	return written - offset, nil
+}
+
+type downloadStatusError struct {
+	code   int
+	status string
+}
+
+func (e *downloadStatusError) Error() string {
+	return "recieved an unexpected response: " + e.status
+}
+
+// parseContentRange parses a Content-Range header such as
+// "bytes 100-199/1000" or "bytes */1000". The start is -1 for the latter and
+// the size is -1 when unknown.
+func parseContentRange(header string) (start, size int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, total, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size = -1
+	if total != "*" {
+		n, err := strconv.ParseInt(total, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		size = n
+	}
+
+	if rng == "*" {
+		return -1, size, true
+	}
+	first, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+
+	return start, size, true
+}
+
+// responseValidator returns the value to send in If-Range to resume from res,
+// which is a strong ETag or else the Last-Modified date.
+func responseValidator(res *http.Response) string {
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return res.Header.Get("Last-Modified")
+}
+
+func (d *Downloader) fetch(ctx context.Context, w io.Writer, written *int64, restart func() error, remember func(string)) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", d.url, nil)
+	if err != nil {
+		return false, err
+	}
+	// Without a validator there is no way to tell whether the file changed,
+	// so the download starts over.
+	if *written > 0 && d.validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", *written))
+		req.Header.Set("If-Range", d.validator)
+	}
+
+	res, err := d.client.Http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	total := d.Size
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		// Data for any other offset than requested cannot be appended.
+		if start, _, ok := parseContentRange(res.Header.Get("Content-Range")); !ok || start != *written {
+			if err = restart(); err != nil {
+				return false, err
+			}
+			return false, errRestartDownload
+		}
+		if total <= 0 && res.ContentLength >= 0 {
+			total = *written + res.ContentLength
+		}
+	case http.StatusOK:
+		// The range was not honored, because the file changed or the server
+		// does not support it.
+		if *written > 0 {
+			if err = restart(); err != nil {
+				return false, err
+			}
+		}
+		if res.ContentLength >= 0 {
+			total = res.ContentLength
+			d.Size = total
+		}
+		if v := responseValidator(res); v != d.validator {
+			d.validator = v
+			if remember != nil && v != "" {
+				remember(v)
+			}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The whole file was received only if the remote size matches the
+		// partial data, otherwise the data is stale and is thrown away.
+		if _, size, ok := parseContentRange(res.Header.Get("Content-Range")); ok && size == *written {
+			return true, nil
+		}
+		if *written == 0 {
+			return false, &downloadStatusError{code: res.StatusCode, status: res.Status}
+		}
+		if err = restart(); err != nil {
+			return false, err
+		}
+		return false, errRestartDownload
+	default:
+		return false, &downloadStatusError{code: res.StatusCode, status: res.Status}
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := res.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return false, werr
+			}
+			*written += int64(n)
+			if d.Progress != nil {
+				d.Progress(*written, total)
+			}
+		}
+
+		if rerr == io.EOF {
+			if total > 0 && *written < total {
+				return false, io.ErrUnexpectedEOF
+			}
+			return true, nil
+		}
+		if rerr != nil {
+			return false, rerr
+		}
+	}
+}
+
+// DownloadDirectory compresses the remote directory on the server, downloads
+// the archive and extracts it into dest, so the directory ends up at
+// dest/<name>. The archive is deleted from the server afterwards, whether or
+// not the download succeeded.
+func (c *Client) DownloadDirectory(ctx context.Context, identifier, remote, dest string) (err error) {
+	remote = path.Clean("/" + remote)
+	if remote == "/" {
+		return errors.New("cannot download the server root directory")
+	}
+	root, name := path.Split(remote)
+
+	archive, err := c.CompressServerFilesArchive(identifier, CompressDescriptor{Root: root, Files: []string{name}})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		derr := c.DeleteServerFiles(identifier, DeleteFilesDescriptor{Root: root, Files: []string{archive.Name}})
+		if err == nil {
+			err = derr
+		}
+	}()
+
+	dl, err := c.DownloadServerFile(identifier, path.Join(root, archive.Name))
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "crocgodyl-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	local := filepath.Join(tmp, archive.Name)
+	if err = dl.ExecuteTo(ctx, local); err != nil {
+		return err
+	}
+
+	return ExtractArchive(local, dest)
+}
@@ -0,0 +1,323 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cutWriter passes the first limit bytes of a response through and drops
+// the rest, so the client sees the connection break.
+type cutWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *cutWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		b = b[:w.limit]
+	}
+	w.limit -= len(b)
+
+	return w.ResponseWriter.Write(b)
+}
+
+// dropFirstDownload breaks off the first download response halfway and
+// records the headers of every download request.
+func dropFirstDownload(requests *[]http.Header) func(http.Handler) http.Handler {
+	var once sync.Once
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/download/file" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			*requests = append(*requests, r.Header.Clone())
+			drop := false
+			once.Do(func() { drop = true })
+			if !drop {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(&cutWriter{ResponseWriter: w, limit: 1000}, r)
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		})
+	}
+}
+
+func TestDownloadResumesWithFreshURL(t *testing.T) {
+	m := NewMemoryFS()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	m.WriteFile("world.zip", data, 0o644)
+
+	var requests []http.Header
+	c := newTestPanelWith(t, m, dropFirstDownload(&requests))
+
+	dl, err := c.DownloadServerFile("abc", "world.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "world.zip")
+	if err = dl.ExecuteTo(context.Background(), dest); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(dest)
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("downloaded file differs (%d bytes), %v", len(b), err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected two download requests, got %d", len(requests))
+	}
+	if requests[1].Get("Range") != "bytes=1000-" || requests[1].Get("If-Range") == "" {
+		t.Fatalf("expected a conditional range request, got %v", requests[1])
+	}
+	if _, err = os.Stat(dest + ".part.meta"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("the validator of the partial file was left behind")
+	}
+}
+
+func TestDownloadRestartsWhenRemoteChanged(t *testing.T) {
+	m := NewMemoryFS()
+	old := []byte(strings.Repeat("a", 5000))
+	m.WriteFile("world.zip", old, 0o644)
+
+	var requests []http.Header
+	c := newTestPanelWith(t, m, dropFirstDownload(&requests))
+
+	dl, err := c.DownloadServerFile("abc", "world.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl.Retries = 0
+
+	dest := filepath.Join(t.TempDir(), "world.zip")
+	if err = dl.ExecuteTo(context.Background(), dest); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if info, err := os.Stat(dest + ".part"); err != nil || info.Size() != 1000 {
+		t.Fatalf("expected 1000 bytes of partial data, got %v", err)
+	}
+
+	data := []byte(strings.Repeat("b", 6000))
+	m.WriteFile("world.zip", data, 0o644)
+
+	dl, err = c.DownloadServerFile("abc", "world.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dl.ExecuteTo(context.Background(), dest); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(dest)
+	if !bytes.Equal(b, data) {
+		t.Fatalf("the partial data of the old file was kept: %q...", b[:10])
+	}
+	if requests[1].Get("If-Range") == "" {
+		t.Fatal("expected the resume to be conditional")
+	}
+}
+
+func TestDownloadRefusesToOverwrite(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("server.properties", []byte("motd=hi\n"), 0o644)
+	c := newTestPanel(t, m)
+
+	dest := filepath.Join(t.TempDir(), "server.properties")
+	os.WriteFile(dest, []byte("local"), 0o644)
+
+	dl, err := c.DownloadServerFile("abc", "server.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dl.ExecuteTo(context.Background(), dest); err == nil {
+		t.Fatal("expected an existing file not to be overwritten")
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "local" {
+		t.Fatalf("the existing file was changed to %q", b)
+	}
+
+	dl.Overwrite = true
+	if err = dl.ExecuteTo(context.Background(), dest); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != "motd=hi\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+}
+
+func TestDownloadWriterReportsChange(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("latest.log", []byte(strings.Repeat("a", 5000)), 0o644)
+
+	var requests []http.Header
+	var c *Client
+	c = newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		drop := dropFirstDownload(&requests)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The file changes while the first response is being sent.
+			if r.URL.Path == "/download/file" && len(requests) == 1 {
+				m.WriteFile("latest.log", []byte(strings.Repeat("b", 5000)), 0o644)
+			}
+			drop.ServeHTTP(w, r)
+		})
+	})
+
+	dl, err := c.DownloadServerFile("abc", "latest.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err = dl.ExecuteWriter(context.Background(), &buf); !errors.Is(err, ErrRemoteChanged) {
+		t.Fatalf("expected ErrRemoteChanged, got %v", err)
+	}
+}
+
+// answerRanges replies to ranged download requests with respond and passes
+// every other request on.
+func answerRanges(respond func(w http.ResponseWriter, r *http.Request)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/download/file" && r.Header.Get("Range") != "" {
+				respond(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writePartial leaves partial data of an earlier download next to dest.
+func writePartial(t *testing.T, dest string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(dest+".part", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest+".part.meta", []byte(`"etag"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadRangeNotSatisfiable(t *testing.T) {
+	data := []byte(strings.Repeat("b", 2000))
+
+	tests := []struct {
+		name    string
+		partial []byte
+		want    []byte
+	}{
+		{name: "complete", partial: data, want: data},
+		{name: "stale larger partial", partial: []byte(strings.Repeat("a", 3000)), want: data},
+		{name: "changed remote", partial: []byte(strings.Repeat("a", 2000)), want: data[:1500]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryFS()
+			m.WriteFile("world.zip", tt.want, 0o644)
+
+			c := newTestPanelWith(t, m, answerRanges(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(tt.want)))
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			}))
+
+			dl, err := c.DownloadServerFile("abc", "world.zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Without a known size the partial data is only checked by the
+			// server's response.
+			dl.Size = 0
+
+			dest := filepath.Join(t.TempDir(), "world.zip")
+			writePartial(t, dest, tt.partial)
+			if err = dl.ExecuteTo(context.Background(), dest); err != nil {
+				t.Fatal(err)
+			}
+
+			if b, _ := os.ReadFile(dest); !bytes.Equal(b, tt.want) {
+				t.Fatalf("expected %d bytes of the remote file, got %q...", len(tt.want), b[:10])
+			}
+		})
+	}
+}
+
+func TestDownloadRejectsWrongRange(t *testing.T) {
+	m := NewMemoryFS()
+	data := []byte(strings.Repeat("0123456789", 200))
+	m.WriteFile("world.zip", data, 0o644)
+
+	ranged := 0
+	c := newTestPanelWith(t, m, answerRanges(func(w http.ResponseWriter, r *http.Request) {
+		// The range is ignored, but the response still claims to be partial.
+		ranged++
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(data)-1, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data)
+	}))
+
+	dl, err := c.DownloadServerFile("abc", "world.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "world.zip")
+	writePartial(t, dest, data[:500])
+	if err = dl.ExecuteTo(context.Background(), dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(dest); !bytes.Equal(b, data) {
+		t.Fatalf("downloaded file differs (%d bytes)", len(b))
+	}
+	if ranged != 1 {
+		t.Fatalf("expected a single ranged request, got %d", ranged)
+	}
+}
+
+func TestDownloadDirectory(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("data/world/level.dat", []byte("level"), 0o644)
+	m.WriteFile("data/world/region/r.0.0.mca", []byte("region"), 0o644)
+	m.WriteFile("data/other.txt", []byte("other"), 0o644)
+	c := newTestPanel(t, m)
+
+	dest := t.TempDir()
+	if err := c.DownloadDirectory(context.Background(), "abc", "data/world/", dest); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"world/level.dat": "level", "world/region/r.0.0.mca": "region"} {
+		if b, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name))); err != nil || string(b) != want {
+			t.Errorf("%s: got %q, %v", name, b, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "other.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected only the directory to be downloaded, got %v", err)
+	}
+
+	// The archive is removed from the server again.
+	want := "data/other.txt,data/world/level.dat,data/world/region/r.0.0.mca"
+	if files := strings.Join(m.Files(), ","); files != want {
+		t.Fatalf("unexpected files left on the server %s", files)
+	}
+
+	if err := c.DownloadDirectory(context.Background(), "abc", "/", dest); err == nil {
+		t.Fatal("expected the server root to be rejected")
+	}
+}
@@ -0,0 +1,134 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrEditConflict = errors.New("file was modified by someone else while being edited")
+
+func (c *Client) statServerFile(identifier, file string) (*File, error) {
+	info, err := c.ServerFS(identifier).Stat(strings.TrimPrefix(remotePath(file), "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	return info.Sys().(*File), nil
+}
+
+func sameRevision(a, b *File) bool {
+	if a.Size != b.Size || (a.ModifiedAt == nil) != (b.ModifiedAt == nil) {
+		return false
+	}
+
+	return a.ModifiedAt == nil || a.ModifiedAt.Equal(*b.ModifiedAt)
+}
+
+func (c *Client) renameServerFile(identifier, dir, from, to string) error {
+	files := RenameDescriptor{Root: dir}
+	files.Files = append(files.Files, struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{From: from, To: to})
+
+	return c.RenameServerFiles(identifier, files)
+}
+
+// EditFile replaces the contents of file with the result of edit. The new
+// contents are written to a temporary file next to it first, and if the
+// size, modification time or contents of file changed since it was read the
+// edit is abandoned with ErrEditConflict. Wings refuses to rename onto an existing
+// file, so the original is moved aside before the temporary file takes its
+// place and restored if that fails.
+func (c *Client) EditFile(identifier, file string, edit func([]byte) ([]byte, error)) error {
+	file = remotePath(file)
+	dir, name := path.Dir(file), path.Base(file)
+
+	before, err := c.statServerFile(identifier, file)
+	if err != nil {
+		return err
+	}
+	if !before.IsFile {
+		return fmt.Errorf("%s is not a file", file)
+	}
+
+	content, err := c.GetServerFileContents(identifier, file)
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) != before.Size {
+		return fmt.Errorf("%w: %s", ErrEditConflict, file)
+	}
+
+	edited, err := edit(content)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(content, edited) {
+		return nil
+	}
+
+	stamp := time.Now().UnixNano()
+	temp := fmt.Sprintf(".%s.%d.tmp", name, stamp)
+	backup := fmt.Sprintf(".%s.%d.bak", name, stamp)
+
+	if err = c.WriteServerFileBytes(identifier, path.Join(dir, temp), "application/octet-stream", edited); err != nil {
+		return err
+	}
+
+	discard := func() {
+		_ = c.DeleteServerFiles(identifier, DeleteFilesDescriptor{Root: dir, Files: []string{temp}})
+	}
+
+	current, err := c.statServerFile(identifier, file)
+	if err != nil {
+		discard()
+		return err
+	}
+	if !sameRevision(before, current) {
+		discard()
+		return fmt.Errorf("%w: %s", ErrEditConflict, file)
+	}
+
+	// Modification times only have a precision of one second, so a write of
+	// the same size within that second only shows in the contents.
+	latest, err := c.GetServerFileContents(identifier, file)
+	if err != nil {
+		discard()
+		return err
+	}
+	if !bytes.Equal(latest, content) {
+		discard()
+		return fmt.Errorf("%w: %s", ErrEditConflict, file)
+	}
+
+	if err = c.renameServerFile(identifier, dir, name, backup); err != nil {
+		discard()
+		return err
+	}
+	if err = c.renameServerFile(identifier, dir, temp, name); err != nil {
+		if restoreErr := c.renameServerFile(identifier, dir, backup, name); restoreErr != nil {
+			return fmt.Errorf("%w (original kept as %s: %v)", err, path.Join(dir, backup), restoreErr)
+		}
+		discard()
+		return err
+	}
+
+	if perm := before.FileMode().Perm(); perm != 0o644 && perm != 0 {
+		files := ChmodDescriptor{Root: dir}
+		files.Files = append(files.Files, struct {
+			File string `json:"file"`
+			Mode uint32 `json:"mode"`
+		}{File: name, Mode: chmodMode(perm)})
+
+		if err = c.ChmodServerFiles(identifier, files); err != nil {
+			return err
+		}
+	}
+
+	return c.DeleteServerFiles(identifier, DeleteFilesDescriptor{Root: dir, Files: []string{backup}})
+}
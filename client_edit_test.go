@@ -0,0 +1,145 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEditFile(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("config/server.properties", []byte("motd=hi\nport=1\n"), 0o644)
+	m.Chmod("config/server.properties", 0o600)
+	c := newTestPanel(t, m)
+
+	err := c.EditFile("abc", "config/server.properties", func(b []byte) ([]byte, error) {
+		return bytes.Replace(b, []byte("port=1"), []byte("port=2"), 1), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := m.ReadFile("config/server.properties"); string(b) != "motd=hi\nport=2\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+	if info, _ := m.Stat("config/server.properties"); info.Mode().Perm() != 0o600 {
+		t.Fatalf("the permissions were not kept: %v", info.Mode())
+	}
+	if files := m.Files(); len(files) != 1 {
+		t.Fatalf("temporary files were left behind: %q", files)
+	}
+}
+
+func TestEditFileUnchanged(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("server.properties", []byte("motd=hi\n"), 0o644)
+
+	var writes int
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/files/write") {
+				writes++
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	if err := c.EditFile("abc", "server.properties", func(b []byte) ([]byte, error) { return b, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 0 {
+		t.Fatalf("expected nothing to be written, got %d writes", writes)
+	}
+
+	failed := errors.New("failed")
+	if err := c.EditFile("abc", "server.properties", func(b []byte) ([]byte, error) { return nil, failed }); !errors.Is(err, failed) {
+		t.Fatalf("expected the edit error, got %v", err)
+	}
+}
+
+func TestEditFileConflict(t *testing.T) {
+	tests := []struct {
+		name  string
+		write []byte
+	}{
+		{name: "size changed", write: []byte("motd=changed\n")},
+		// The clock is frozen, so only the contents tell the versions apart.
+		{name: "same size and second", write: []byte("motd=yo\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryFS()
+			frozen := time.Now().Truncate(time.Second)
+			m.now = func() time.Time { return frozen }
+			m.WriteFile("server.properties", []byte("motd=hi\n"), 0o644)
+
+			// Someone else saves the file while the edit is uploaded.
+			var once sync.Once
+			c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r)
+					if strings.HasSuffix(r.URL.Path, "/files/write") {
+						once.Do(func() { m.WriteFile("server.properties", tt.write, 0o644) })
+					}
+				})
+			})
+
+			err := c.EditFile("abc", "server.properties", func(b []byte) ([]byte, error) {
+				return []byte("motd=edited\n"), nil
+			})
+			if !errors.Is(err, ErrEditConflict) {
+				t.Fatalf("expected a conflict, got %v", err)
+			}
+
+			if b, _ := m.ReadFile("server.properties"); !bytes.Equal(b, tt.write) {
+				t.Fatalf("the concurrent write was overwritten with %q", b)
+			}
+			if files := m.Files(); len(files) != 1 {
+				t.Fatalf("temporary files were left behind: %q", files)
+			}
+		})
+	}
+}
+
+func TestEditFileRestoresBackup(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("server.properties", []byte("motd=hi\n"), 0o644)
+
+	// The rename of the temporary file onto the original fails, after the
+	// original was moved aside.
+	renames := 0
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/files/rename") {
+				if renames++; renames == 2 {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{"errors":[{"code":"Error","status":"500","detail":"error"}]}`))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	err := c.EditFile("abc", "server.properties", func(b []byte) ([]byte, error) {
+		return []byte("motd=edited\n"), nil
+	})
+	if err == nil || errors.Is(err, ErrEditConflict) {
+		t.Fatalf("expected the rename error, got %v", err)
+	}
+	if renames != 3 {
+		t.Fatalf("expected the backup to be moved back, got %d renames", renames)
+	}
+
+	if b, _ := m.ReadFile("server.properties"); string(b) != "motd=hi\n" {
+		t.Fatalf("the original was not restored: %q", b)
+	}
+	if files := m.Files(); len(files) != 1 {
+		t.Fatalf("temporary files were left behind: %q", files)
+	}
+}
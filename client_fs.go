@@ -0,0 +1,674 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMode converts the octal ModeBits and the type flags reported by Wings
+// into an fs.FileMode.
+func (f *File) FileMode() fs.FileMode {
+	bits, _ := strconv.ParseUint(f.ModeBits, 8, 32)
+	mode := fs.FileMode(bits) & fs.ModePerm
+
+	switch {
+	case f.IsSymlink:
+		mode |= fs.ModeSymlink
+	case !f.IsFile:
+		mode |= fs.ModeDir
+	}
+
+	return mode
+}
+
+func (f *File) ModTime() time.Time {
+	if f.ModifiedAt != nil {
+		return *f.ModifiedAt
+	}
+	if f.CreatedAt != nil {
+		return *f.CreatedAt
+	}
+
+	return time.Time{}
+}
+
+type fileInfo struct {
+	file *File
+}
+
+func (i *fileInfo) Name() string               { return i.file.Name }
+func (i *fileInfo) Size() int64                { return i.file.Size }
+func (i *fileInfo) Mode() fs.FileMode          { return i.file.FileMode() }
+func (i *fileInfo) ModTime() time.Time         { return i.file.ModTime() }
+func (i *fileInfo) IsDir() bool                { return i.Mode().IsDir() }
+func (i *fileInfo) Sys() any                   { return i.file }
+func (i *fileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i *fileInfo) String() string             { return fs.FormatDirEntry(i) }
+
+type cachedListing struct {
+	files   []*File
+	expires time.Time
+}
+
+// ServerFS exposes the files of a server as an fs.FS and WritableFS.
+// Directory listings are cached for CacheTTL when it is set and dropped on
+// every change made through ServerFS.
+type ServerFS struct {
+	client     *Client
+	identifier string
+	CacheTTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedListing
+}
+
+var (
+	_ fs.FS         = (*ServerFS)(nil)
+	_ fs.ReadDirFS  = (*ServerFS)(nil)
+	_ fs.StatFS     = (*ServerFS)(nil)
+	_ fs.ReadFileFS = (*ServerFS)(nil)
+)
+
+func (c *Client) ServerFS(identifier string) *ServerFS {
+	return &ServerFS{client: c, identifier: identifier}
+}
+
+func (s *ServerFS) Client() *Client {
+	return s.client
+}
+
+func (s *ServerFS) Identifier() string {
+	return s.identifier
+}
+
+// Invalidate drops cached listings of the given directories, or every cached
+// listing when none are given.
+func (s *ServerFS) Invalidate(dirs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(dirs) == 0 {
+		s.cache = nil
+		return
+	}
+	for _, dir := range dirs {
+		delete(s.cache, remotePath(dir))
+	}
+}
+
+func remotePath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func isNotFound(err error) bool {
+	var api *ApiError
+	if errors.As(err, &api) {
+		for _, e := range api.Errors {
+			if e.Status == "404" || e.Code == "NotFoundHttpException" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func fsError(op, name string, err error) error {
+	if isNotFound(err) {
+		err = fs.ErrNotExist
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (s *ServerFS) list(dir string) ([]*File, error) {
+	dir = remotePath(dir)
+
+	if s.CacheTTL > 0 {
+		s.mu.Lock()
+		cached, ok := s.cache[dir]
+		s.mu.Unlock()
+		if ok && time.Now().Before(cached.expires) {
+			return cached.files, nil
+		}
+	}
+
+	files, err := s.client.GetServerFiles(s.identifier, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.CacheTTL > 0 {
+		s.mu.Lock()
+		if s.cache == nil {
+			s.cache = map[string]cachedListing{}
+		}
+		s.cache[dir] = cachedListing{files: files, expires: time.Now().Add(s.CacheTTL)}
+		s.mu.Unlock()
+	}
+
+	return files, nil
+}
+
+func (s *ServerFS) stat(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return &fileInfo{file: &File{Name: ".", Mode: "drwxr-xr-x", ModeBits: "755"}}, nil
+	}
+
+	dir, base := path.Split(name)
+	files, err := s.list(dir)
+	if err != nil {
+		return nil, fsError(op, name, err)
+	}
+
+	for _, f := range files {
+		if f.Name == base {
+			return &fileInfo{file: f}, nil
+		}
+	}
+
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// walkServerDir walks the remote directory with paths relative to it. A
+// missing directory is treated as empty.
+func walkServerDir(ctx context.Context, fsys *ServerFS, remote string, fn fs.WalkDirFunc) error {
+	root := strings.TrimPrefix(remotePath(remote), "/")
+	if root == "" {
+		root = "."
+	}
+
+	if _, err := fsys.Stat(root); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		return err
+	}
+
+	return fs.WalkDir(sub, ".", func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fn(p, d, err)
+	})
+}
+
+func (s *ServerFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (s *ServerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	files, err := s.list(name)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, &fileInfo{file: f})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (s *ServerFS) ReadFile(name string) ([]byte, error) {
+	info, err := s.stat("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+
+	buf, err := s.client.GetServerFileContents(s.identifier, remotePath(name))
+	if err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+
+	return buf, nil
+}
+
+func (s *ServerFS) Open(name string) (fs.File, error) {
+	info, err := s.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverFile{fsys: s, name: name, info: info}, nil
+}
+
+// serverFile is returned by ServerFS.Open. Contents of regular files are
+// fetched on the first read and kept in memory, so the file can be seeked
+// as http.FileServer requires.
+type serverFile struct {
+	fsys *ServerFS
+	name string
+	info *fileInfo
+
+	reader  *bytes.Reader
+	entries []fs.DirEntry
+	listed  bool
+	closed  bool
+}
+
+var (
+	_ fs.ReadDirFile = (*serverFile)(nil)
+	_ io.ReadSeeker  = (*serverFile)(nil)
+	_ http.File      = (*serverFile)(nil)
+)
+
+func (f *serverFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *serverFile) load(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.info.IsDir() {
+		return &fs.PathError{Op: op, Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.reader != nil {
+		return nil
+	}
+
+	buf, err := f.fsys.client.GetServerFileContents(f.fsys.identifier, remotePath(f.name))
+	if err != nil {
+		return fsError(op, f.name, err)
+	}
+
+	f.reader = bytes.NewReader(buf)
+	return nil
+}
+
+func (f *serverFile) Read(b []byte) (int, error) {
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+
+	return f.reader.Read(b)
+}
+
+func (f *serverFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load("seek"); err != nil {
+		return 0, err
+	}
+
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *serverFile) ReadAt(b []byte, off int64) (int, error) {
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+
+	return f.reader.ReadAt(b, off)
+}
+
+func (f *serverFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+
+	if !f.listed {
+		entries, err := f.fsys.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.listed = true
+	}
+
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *serverFile) Readdir(n int) ([]fs.FileInfo, error) {
+	entries, err := f.ReadDir(n)
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		infos = append(infos, e.(*fileInfo))
+	}
+
+	return infos, err
+}
+
+func (f *serverFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+	f.reader = nil
+	return nil
+}
+
+type WritableFile interface {
+	io.Writer
+	io.Closer
+	Name() string
+}
+
+// WritableFS is a read/write filesystem. ServerFS implements it on top of the
+// file manager API and MemoryFS in memory, for code that needs to be tested
+// without a panel.
+type WritableFS interface {
+	fs.FS
+	fs.ReadDirFS
+	fs.StatFS
+	fs.ReadFileFS
+
+	Create(name string) (WritableFile, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+	Chmod(name string, mode fs.FileMode) error
+	Copy(name string) error
+}
+
+var _ WritableFS = (*ServerFS)(nil)
+
+// chmodMode converts permission bits into the octal digits Wings expects,
+// e.g. 0o755 becomes 755.
+func chmodMode(perm fs.FileMode) uint32 {
+	mode, _ := strconv.ParseUint(strconv.FormatUint(uint64(perm.Perm()), 8), 10, 32)
+	return uint32(mode)
+}
+
+func validWritePath(op, name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return nil
+}
+
+func (s *ServerFS) invalidateParent(name string) {
+	s.Invalidate(path.Dir(name), name)
+}
+
+type serverFileWriter struct {
+	fsys   *ServerFS
+	name   string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *serverFileWriter) Name() string {
+	return w.name
+}
+
+func (w *serverFileWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	return w.buf.Write(b)
+}
+
+// Close uploads the buffered contents; nothing is written to the server
+// before the file is closed.
+func (w *serverFileWriter) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+	w.closed = true
+
+	err := w.fsys.client.WriteServerFileBytes(w.fsys.identifier, remotePath(w.name), "application/octet-stream", w.buf.Bytes())
+	w.fsys.invalidateParent(w.name)
+	if err != nil {
+		return fsError("write", w.name, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFS) Create(name string) (WritableFile, error) {
+	return s.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// OpenFile opens name for writing with the os.O_* flags. Files are only
+// written, never read back through the returned handle; use Open to read.
+func (s *ServerFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if err := validWritePath("open", name); err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("only write access is supported")}
+	}
+
+	info, err := s.stat("open", name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	exists := err == nil
+	switch {
+	case exists && info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	w := &serverFileWriter{fsys: s, name: name}
+	if exists && flag&os.O_APPEND != 0 && flag&os.O_TRUNC == 0 {
+		buf, err := s.client.GetServerFileContents(s.identifier, remotePath(name))
+		if err != nil {
+			return nil, fsError("open", name, err)
+		}
+		w.buf.Write(buf)
+	}
+
+	return w, nil
+}
+
+func (s *ServerFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := validWritePath("write", name); err != nil {
+		return err
+	}
+
+	err := s.client.WriteServerFileBytes(s.identifier, remotePath(name), "application/octet-stream", data)
+	s.invalidateParent(name)
+	if err != nil {
+		return fsError("write", name, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := validWritePath("mkdir", name); err != nil {
+		return err
+	}
+
+	if _, err := s.stat("mkdir", name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if dir := path.Dir(name); dir != "." {
+		info, err := s.stat("mkdir", dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("parent is not a directory")}
+		}
+	}
+
+	return s.MkdirAll(name, perm)
+}
+
+func (s *ServerFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := validWritePath("mkdir", name); err != nil {
+		if name == "." {
+			return nil
+		}
+		return err
+	}
+
+	dir, base := path.Split(remotePath(name))
+	err := s.client.CreateServerFileFolder(s.identifier, CreateFolderDescriptor{Root: dir, Name: base})
+	s.invalidateParent(name)
+	if err != nil {
+		return fsError("mkdir", name, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFS) Remove(name string) error {
+	info, err := s.stat("remove", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if info.IsDir() {
+		files, err := s.list(name)
+		if err != nil {
+			return fsError("remove", name, err)
+		}
+		if len(files) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+
+	return s.RemoveAll(name)
+}
+
+func (s *ServerFS) RemoveAll(name string) error {
+	if err := validWritePath("remove", name); err != nil {
+		return err
+	}
+
+	if _, err := s.stat("remove", name); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	dir, base := path.Split(remotePath(name))
+	err := s.client.DeleteServerFiles(s.identifier, DeleteFilesDescriptor{Root: dir, Files: []string{base}})
+	s.Invalidate()
+	if err != nil {
+		return fsError("remove", name, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFS) Rename(oldname, newname string) error {
+	if err := validWritePath("rename", oldname); err != nil {
+		return err
+	}
+	if err := validWritePath("rename", newname); err != nil {
+		return err
+	}
+
+	files := RenameDescriptor{Root: "/"}
+	files.Files = append(files.Files, struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{From: oldname, To: newname})
+
+	err := s.client.RenameServerFiles(s.identifier, files)
+	s.Invalidate()
+	if err != nil {
+		return fsError("rename", oldname, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFS) Chmod(name string, mode fs.FileMode) error {
+	if err := validWritePath("chmod", name); err != nil {
+		return err
+	}
+
+	dir, base := path.Split(remotePath(name))
+	files := ChmodDescriptor{Root: dir}
+	files.Files = append(files.Files, struct {
+		File string `json:"file"`
+		Mode uint32 `json:"mode"`
+	}{File: base, Mode: chmodMode(mode)})
+
+	err := s.client.ChmodServerFiles(s.identifier, files)
+	s.invalidateParent(name)
+	if err != nil {
+		return fsError("chmod", name, err)
+	}
+
+	return nil
+}
+
+// Copy duplicates name next to itself, the way the panel does: "a.txt"
+// becomes "a copy.txt".
+func (s *ServerFS) Copy(name string) error {
+	if err := validWritePath("copy", name); err != nil {
+		return err
+	}
+
+	err := s.client.CopyServerFile(s.identifier, remotePath(name))
+	s.invalidateParent(name)
+	if err != nil {
+		return fsError("copy", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package crocgodyl
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestServerFS(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("server.properties", []byte("motd=hi\n"), 0o644)
+	m.WriteFile("plugins/a.jar", []byte("a"), 0o644)
+	m.WriteFile("plugins/config/a.yml", []byte("a: 1\n"), 0o600)
+	m.MkdirAll("world/region", 0o755)
+	fsys := newTestPanel(t, m).ServerFS("abc")
+
+	if err := fstest.TestFS(fsys, "server.properties", "plugins/a.jar", "plugins/config/a.yml", "world/region"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fsys.Stat("plugins/config/a.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 5 || info.Mode() != 0o600 || info.Sys().(*File).Name != "a.yml" {
+		t.Fatalf("unexpected info %v", info)
+	}
+
+	var walked []string
+	fs.WalkDir(fsys, "plugins", func(p string, d fs.DirEntry, err error) error {
+		walked = append(walked, p)
+		return err
+	})
+	if got := strings.Join(walked, ","); got != "plugins,plugins/a.jar,plugins/config,plugins/config/a.yml" {
+		t.Fatalf("unexpected walk %s", got)
+	}
+}
+
+func TestServerFSErrors(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("plugins/a.jar", []byte("a"), 0o644)
+	fsys := newTestPanel(t, m).ServerFS("abc")
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "stat missing", call: func() error { _, err := fsys.Stat("plugins/b.jar"); return err }, want: fs.ErrNotExist},
+		{name: "stat in missing directory", call: func() error { _, err := fsys.Stat("mods/b.jar"); return err }, want: fs.ErrNotExist},
+		{name: "readdir missing", call: func() error { _, err := fsys.ReadDir("mods"); return err }, want: fs.ErrNotExist},
+		{name: "open invalid", call: func() error { _, err := fsys.Open("../plugins"); return err }, want: fs.ErrInvalid},
+		{name: "open absolute", call: func() error { _, err := fsys.Open("/plugins"); return err }, want: fs.ErrInvalid},
+		{name: "write root", call: func() error { return fsys.WriteFile(".", nil, 0o644) }, want: fs.ErrInvalid},
+		{name: "create existing exclusively", call: func() error {
+			_, err := fsys.OpenFile("plugins/a.jar", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			return err
+		}, want: fs.ErrExist},
+		{name: "open missing without create", call: func() error {
+			_, err := fsys.OpenFile("plugins/b.jar", os.O_WRONLY, 0o644)
+			return err
+		}, want: fs.ErrNotExist},
+		{name: "mkdir existing", call: func() error { return fsys.Mkdir("plugins", 0o755) }, want: fs.ErrExist},
+		{name: "mkdir without parent", call: func() error { return fsys.Mkdir("mods/config", 0o755) }, want: fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if _, err := fsys.ReadFile("plugins"); err == nil {
+		t.Error("expected reading a directory to fail")
+	}
+	if err := fsys.Remove("plugins"); err == nil {
+		t.Error("expected removing a directory that is not empty to fail")
+	}
+	if _, err := fsys.OpenFile("plugins/a.jar", os.O_RDONLY, 0); err == nil {
+		t.Error("expected opening for reading to be refused")
+	}
+}
+
+func TestServerFSWrite(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("logs/latest.log", []byte("one\n"), 0o644)
+	fsys := newTestPanel(t, m).ServerFS("abc")
+
+	w, err := fsys.OpenFile("logs/latest.log", os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "two\n")
+	if b, _ := m.ReadFile("logs/latest.log"); string(b) != "one\n" {
+		t.Fatalf("written before the file was closed: %q", b)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fsys.ReadFile("logs/latest.log"); string(b) != "one\ntwo\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+
+	if err = fsys.Mkdir("logs/old", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err = fsys.Rename("logs/latest.log", "logs/old/1.log"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fsys.Chmod("logs/old/1.log", 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = fsys.Copy("logs/old/1.log"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := m.Stat("logs/old/1.log"); info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected mode %v", info.Mode())
+	}
+
+	if err = fsys.Remove("logs/old/1 copy.log"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fsys.RemoveAll("logs/missing"); err != nil {
+		t.Fatalf("expected removing a missing file to succeed, got %v", err)
+	}
+
+	if files := strings.Join(m.Files(), ","); files != "logs/old/1.log" {
+		t.Fatalf("unexpected files %s", files)
+	}
+}
+
+func TestServerFSCache(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("plugins/a.jar", []byte("a"), 0o644)
+
+	var listings int32
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/files/list") {
+				atomic.AddInt32(&listings, 1)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	fsys := c.ServerFS("abc")
+	fsys.CacheTTL = time.Minute
+
+	fsys.ReadDir("plugins")
+	fsys.Stat("plugins/a.jar")
+	if n := atomic.LoadInt32(&listings); n != 1 {
+		t.Fatalf("expected the listing to be cached, got %d listings", n)
+	}
+
+	// Changes made behind the cache are only seen once it is dropped.
+	m.WriteFile("plugins/b.jar", []byte("b"), 0o644)
+	if _, err := fsys.Stat("plugins/b.jar"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the cached listing, got %v", err)
+	}
+	fsys.Invalidate("plugins")
+	if _, err := fsys.Stat("plugins/b.jar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes through ServerFS drop the listing of the parent directory.
+	if err := fsys.WriteFile("plugins/c.jar", []byte("c"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := fsys.ReadDir("plugins"); len(entries) != 3 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if n := atomic.LoadInt32(&listings); n != 3 {
+		t.Fatalf("expected 3 listings, got %d", n)
+	}
+}
@@ -0,0 +1,143 @@
+package crocgodyl
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ServerStatusInstalling      = "installing"
+	ServerStatusInstallFailed   = "install_failed"
+	ServerStatusReinstallFailed = "reinstall_failed"
+	ServerStatusSuspended       = "suspended"
+	ServerStatusRestoringBackup = "restoring_backup"
+)
+
+// InstallResult is the outcome of an installation. Log only holds the
+// install output received over the console, so it is empty when the console
+// could not be opened and misses the rest of the output when the connection
+// dropped during the install.
+type InstallResult struct {
+	Identifier  string    `json:"identifier"`
+	Success     bool      `json:"success"`
+	Status      string    `json:"status"`
+	Log         []string  `json:"log"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func installFailed(status string) bool {
+	return status == ServerStatusInstallFailed || status == ServerStatusReinstallFailed
+}
+
+// TrackInstall follows the installation of a server started by CreateServer
+// or Reinstall, calling onLine for every line of install output, and returns
+// once the panel no longer reports the server as installing. Without a
+// console connection, or once it drops, the server is polled instead and no
+// further output is received.
+func (c *Client) TrackInstall(ctx context.Context, identifier string, onLine func(string)) (*InstallResult, error) {
+	result := &InstallResult{Identifier: identifier, StartedAt: time.Now()}
+
+	con, err := c.OpenConsole(ctx, identifier)
+	if err != nil {
+		return c.pollInstall(ctx, result)
+	}
+	defer con.Close()
+
+	events, cancel := con.Subscribe()
+	defer cancel()
+
+	srv, err := c.GetServer(identifier)
+	if err != nil {
+		return nil, err
+	}
+	if !srv.Installing {
+		return c.finishInstall(result, srv), nil
+	}
+
+	con.RequestLogs()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+
+		case ev, ok := <-events:
+			if !ok {
+				return c.pollInstall(ctx, result)
+			}
+
+			switch ev.Event {
+			case EventInstallStarted:
+				result.StartedAt = time.Now()
+
+			case EventInstallOutput:
+				for _, line := range ev.Args {
+					result.Log = append(result.Log, line)
+					if onLine != nil {
+						onLine(line)
+					}
+				}
+
+			case EventInstallCompleted:
+				return c.pollInstall(ctx, result)
+			}
+		}
+	}
+}
+
+func (c *Client) pollInstall(ctx context.Context, result *InstallResult) (*InstallResult, error) {
+	ticker := time.NewTicker(StatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		srv, err := c.GetServer(result.Identifier)
+		if err != nil {
+			return result, err
+		}
+		if !srv.Installing {
+			return c.finishInstall(result, srv), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) finishInstall(result *InstallResult, srv *ClientServer) *InstallResult {
+	result.Status = srv.Status
+	result.Success = !installFailed(srv.Status)
+	result.CompletedAt = time.Now()
+	return result
+}
+
+// WaitForInstall polls the application API until the server has finished
+// installing and reports whether the install succeeded. Use
+// Client.TrackInstall to follow the install output as well.
+func (a *Application) WaitForInstall(ctx context.Context, id int) (*AppServer, bool, error) {
+	ticker := time.NewTicker(StatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		srv, err := a.GetServer(id)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if installFailed(srv.Status) {
+			return srv, false, nil
+		}
+		if srv.Status != ServerStatusInstalling && srv.Container.Installed != 0 {
+			return srv, true, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return srv, false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
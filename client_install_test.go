@@ -0,0 +1,128 @@
+package crocgodyl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// finishInstall makes the fake server report the install as done with the
+// given status.
+func (f *fakeWings) finishInstall(status string) {
+	f.mu.Lock()
+	f.installing, f.status = false, status
+	f.mu.Unlock()
+}
+
+func TestTrackInstall(t *testing.T) {
+	f := newFakeWings(t, "offline")
+	f.installing, f.status = true, ServerStatusInstalling
+	f.onMessage = func(ev ConsoleEvent) {
+		if ev.Event != EventSendLogs {
+			return
+		}
+		f.emit(EventInstallStarted)
+		f.emit(EventInstallOutput, "downloading")
+		f.emit(EventInstallOutput, "extracting", "done")
+		f.finishInstall("")
+		f.emit(EventInstallCompleted)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lines []string
+	result, err := f.client.TrackInstall(ctx, "abc", func(line string) { lines = append(lines, line) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Success || result.Status != "" || result.CompletedAt.Before(result.StartedAt) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if got := strings.Join(result.Log, ","); got != "downloading,extracting,done" {
+		t.Fatalf("unexpected log %q", result.Log)
+	}
+	if strings.Join(lines, ",") != strings.Join(result.Log, ",") {
+		t.Fatalf("onLine got %q", lines)
+	}
+}
+
+func TestTrackInstallNotInstalling(t *testing.T) {
+	f := newFakeWings(t, "offline")
+	f.status = ServerStatusInstallFailed
+
+	result, err := f.client.TrackInstall(context.Background(), "abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Status != ServerStatusInstallFailed {
+		t.Fatalf("expected a failed install, got %+v", result)
+	}
+}
+
+func TestTrackInstallPolls(t *testing.T) {
+	interval := StatePollInterval
+	StatePollInterval = 10 * time.Millisecond
+	defer func() { StatePollInterval = interval }()
+
+	f := newFakeWings(t, "offline")
+	f.installing, f.status, f.noSocket = true, ServerStatusInstalling, true
+	time.AfterFunc(50*time.Millisecond, func() { f.finishInstall(ServerStatusInstallFailed) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := f.client.TrackInstall(ctx, "abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Status != ServerStatusInstallFailed || len(result.Log) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestTrackInstallConsoleDrops(t *testing.T) {
+	interval := StatePollInterval
+	StatePollInterval = 10 * time.Millisecond
+	defer func() { StatePollInterval = interval }()
+
+	f := newFakeWings(t, "offline")
+	f.installing, f.status = true, ServerStatusInstalling
+	f.onMessage = func(ev ConsoleEvent) {
+		if ev.Event != EventSendLogs {
+			return
+		}
+		f.emit(EventInstallOutput, "downloading")
+		f.mu.Lock()
+		for _, conn := range f.conns {
+			conn.Close()
+		}
+		f.mu.Unlock()
+		time.AfterFunc(50*time.Millisecond, func() { f.finishInstall("") })
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := f.client.TrackInstall(ctx, "abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || strings.Join(result.Log, ",") != "downloading" {
+		t.Fatalf("expected the output received before the drop, got %+v", result)
+	}
+}
+
+func TestTrackInstallCanceled(t *testing.T) {
+	f := newFakeWings(t, "offline")
+	f.installing, f.status = true, ServerStatusInstalling
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := f.client.TrackInstall(ctx, "abc", nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be reported, got %v", err)
+	}
+}
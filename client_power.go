@@ -0,0 +1,198 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type PowerSignal string
+
+const (
+	PowerStart   PowerSignal = "start"
+	PowerStop    PowerSignal = "stop"
+	PowerRestart PowerSignal = "restart"
+	PowerKill    PowerSignal = "kill"
+)
+
+func (s PowerSignal) Valid() bool {
+	switch s {
+	case PowerStart, PowerStop, PowerRestart, PowerKill:
+		return true
+	default:
+		return false
+	}
+}
+
+// SendPowerSignal is SetServerPowerState for a typed signal, rejecting
+// unknown signals before they reach the panel.
+func (c *Client) SendPowerSignal(identifier string, signal PowerSignal) error {
+	if !signal.Valid() {
+		return fmt.Errorf("invalid power signal %q", signal)
+	}
+
+	return c.SetServerPowerState(identifier, string(signal))
+}
+
+// noteSignal records a signal about to be sent, before Wings can report the
+// resulting state, and returns a function forgetting it if sending failed.
+func (c *Client) noteSignal(identifier string, signal PowerSignal) func() {
+	switch signal {
+	case PowerStop, PowerKill, PowerRestart:
+	default:
+		return func() {}
+	}
+
+	prev, ok := c.stops.Load(identifier)
+	c.stops.Store(identifier, time.Now())
+	return func() {
+		if ok {
+			c.stops.Store(identifier, prev)
+		} else {
+			c.stops.Delete(identifier)
+		}
+	}
+}
+
+// lastStop returns when a signal taking the server down was last sent to it
+// through c.
+func (c *Client) lastStop(identifier string) time.Time {
+	if t, ok := c.stops.Load(identifier); ok {
+		return t.(time.Time)
+	}
+
+	return time.Time{}
+}
+
+type ServerState string
+
+const (
+	StateOffline  ServerState = "offline"
+	StateStarting ServerState = "starting"
+	StateRunning  ServerState = "running"
+	StateStopping ServerState = "stopping"
+)
+
+func (s ServerState) Valid() bool {
+	switch s {
+	case StateOffline, StateStarting, StateRunning, StateStopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s ServerState) In(states ...ServerState) bool {
+	for _, st := range states {
+		if s == st {
+			return true
+		}
+	}
+
+	return false
+}
+
+var StatePollInterval = 2 * time.Second
+
+// WaitForState blocks until the server reaches one of the given states and
+// returns the state it reached. Status events from the console are used when
+// the socket is reachable, otherwise GetServerResources is polled.
+func (c *Client) WaitForState(ctx context.Context, identifier string, states ...ServerState) (ServerState, error) {
+	if len(states) == 0 {
+		return "", errors.New("at least one state must be specified")
+	}
+
+	con, err := c.OpenConsole(ctx, identifier)
+	if err != nil {
+		return c.pollForState(ctx, identifier, states)
+	}
+	defer con.Close()
+
+	return c.WaitForStateWith(ctx, con, states...)
+}
+
+// WaitForStateWith is like WaitForState but reuses an already open console.
+func (c *Client) WaitForStateWith(ctx context.Context, con *Console, states ...ServerState) (ServerState, error) {
+	if len(states) == 0 {
+		return "", errors.New("at least one state must be specified")
+	}
+
+	events, cancel := con.Subscribe()
+	defer cancel()
+
+	res, err := c.GetServerResources(con.Identifier())
+	if err != nil {
+		return "", err
+	}
+	if st := ServerState(res.State); st.In(states...) {
+		return st, nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+
+		case ev, ok := <-events:
+			if !ok {
+				return c.pollForState(ctx, con.Identifier(), states)
+			}
+			if ev.Event != EventStatus || len(ev.Args) == 0 {
+				continue
+			}
+
+			if st := ServerState(ev.Args[0]); st.In(states...) {
+				return st, nil
+			}
+		}
+	}
+}
+
+func (c *Client) pollForState(ctx context.Context, identifier string, states []ServerState) (ServerState, error) {
+	ticker := time.NewTicker(StatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		res, err := c.GetServerResources(identifier)
+		if err != nil {
+			return "", err
+		}
+		if st := ServerState(res.State); st.In(states...) {
+			return st, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// StopGracefully sends the stop signal and waits up to grace for the server
+// to go offline, escalating to kill if it does not. It reports whether the
+// kill signal had to be sent.
+func (c *Client) StopGracefully(ctx context.Context, identifier string, grace time.Duration) (bool, error) {
+	if err := c.SendPowerSignal(identifier, PowerStop); err != nil {
+		return false, err
+	}
+
+	graceCtx, cancel := context.WithTimeout(ctx, grace)
+	_, err := c.WaitForState(graceCtx, identifier, StateOffline)
+	cancel()
+
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return false, err
+	}
+
+	if err = c.SendPowerSignal(identifier, PowerKill); err != nil {
+		return true, err
+	}
+
+	_, err = c.WaitForState(ctx, identifier, StateOffline)
+	return true, err
+}
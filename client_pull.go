@@ -0,0 +1,171 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+)
+
+var (
+	ErrPullTimeout      = errors.New("remote pull did not finish in time")
+	ErrPullSizeMismatch = errors.New("pulled file does not have the expected size")
+)
+
+type PullOptions struct {
+	ContentLength int64
+	PollInterval  time.Duration
+	StableFor     time.Duration
+	Timeout       time.Duration
+	Progress      func(size, total int64)
+}
+
+// pullTarget returns the name Wings will save the pull as, or an empty
+// string when it is taken from the response headers.
+func pullTarget(file PullDescriptor) (string, error) {
+	u, err := url.Parse(file.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported pull url scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", errors.New("pull url has no host")
+	}
+
+	switch {
+	case file.Filename != "":
+		return path.Base(file.Filename), nil
+	case file.UseHeader:
+		return "", nil
+	}
+
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", errors.New("cannot determine the file name from the pull url")
+	}
+
+	return name, nil
+}
+
+// TrackPull asks Wings to pull a file and waits until it has been written
+// completely, which is assumed once its size stops changing for StableFor,
+// or right away when it reaches ContentLength. A file that already exists
+// under the same name is only considered once its size or modification time
+// changed. Without a Filename and with UseHeader set the file is located by
+// comparing directory listings.
+func (c *Client) TrackPull(ctx context.Context, identifier string, file PullDescriptor, opts PullOptions) (*File, error) {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	if opts.StableFor <= 0 {
+		opts.StableFor = 3 * opts.PollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Minute
+	}
+
+	name, err := pullTarget(file)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := remotePath(file.Directory)
+	if dir != "/" {
+		info, err := c.statServerFile(identifier, dir)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsFile {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+
+	before, err := c.GetServerFiles(identifier, dir)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]*File, len(before))
+	for _, f := range before {
+		previous[f.Name] = f
+	}
+
+	if err = c.PullServerFile(identifier, file); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var (
+		current     *File
+		lastSize    int64 = -1
+		stableSince time.Time
+	)
+	for {
+		files, err := c.GetServerFiles(identifier, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		found := pulledFile(files, previous, name)
+		switch {
+		case found == nil && current != nil:
+			return nil, errors.New("pulled file disappeared, the download probably failed")
+		case found != nil:
+			current = found
+			if current.Size != lastSize {
+				lastSize, stableSince = current.Size, time.Now()
+				if opts.Progress != nil {
+					opts.Progress(current.Size, opts.ContentLength)
+				}
+			}
+
+			done := time.Since(stableSince) >= opts.StableFor || file.Foreground
+			if opts.ContentLength > 0 {
+				if current.Size == opts.ContentLength {
+					return current, nil
+				}
+				if current.Size > opts.ContentLength || done {
+					return current, fmt.Errorf("%w: got %d bytes, expected %d", ErrPullSizeMismatch, current.Size, opts.ContentLength)
+				}
+			} else if done {
+				return current, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return current, ErrPullTimeout
+			}
+			return current, ctx.Err()
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+// pulledFile finds the file being pulled in a listing. A file that was
+// already present only counts once it changed, since the pull overwrites
+// it. When its name is not known in advance the newest file that is new or
+// changed is used.
+func pulledFile(files []*File, previous map[string]*File, name string) *File {
+	var found *File
+	for _, f := range files {
+		if !f.IsFile || (name != "" && f.Name != name) {
+			continue
+		}
+
+		if old, ok := previous[f.Name]; ok && sameRevision(old, f) {
+			continue
+		}
+		if found == nil || fileNewer(f, found) {
+			found = f
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,66 @@
+package crocgodyl
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackPullWaitsForExistingFileToChange(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("plugin.jar", []byte("old"), 0o644)
+
+	// Wings starts writing the pulled file a while after the request.
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/files/pull") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			time.AfterFunc(50*time.Millisecond, func() {
+				m.WriteFile("plugin.jar", []byte("new plugin"), 0o644)
+			})
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	f, err := c.TrackPull(context.Background(), "abc", PullDescriptor{URL: "https://example.com/plugin.jar"}, PullOptions{
+		PollInterval: 10 * time.Millisecond,
+		StableFor:    30 * time.Millisecond,
+		Timeout:      5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size != int64(len("new plugin")) {
+		t.Fatalf("expected the pulled file, got one of %d bytes", f.Size)
+	}
+}
+
+func TestPulledFile(t *testing.T) {
+	at := func(sec int) *time.Time {
+		ts := time.Unix(int64(sec), 0)
+		return &ts
+	}
+	previous := map[string]*File{
+		"a.jar": {Name: "a.jar", IsFile: true, Size: 10, ModifiedAt: at(1)},
+	}
+
+	unchanged := []*File{{Name: "a.jar", IsFile: true, Size: 10, ModifiedAt: at(1)}}
+	if f := pulledFile(unchanged, previous, "a.jar"); f != nil {
+		t.Fatal("an unchanged existing file was taken as the pulled one")
+	}
+
+	touched := []*File{{Name: "a.jar", IsFile: true, Size: 10, ModifiedAt: at(2)}}
+	if f := pulledFile(touched, previous, "a.jar"); f == nil {
+		t.Fatal("expected the rewritten file to be found")
+	}
+
+	added := []*File{unchanged[0], {Name: "b.jar", IsFile: true, Size: 5, ModifiedAt: at(3)}}
+	if f := pulledFile(added, previous, ""); f == nil || f.Name != "b.jar" {
+		t.Fatalf("expected the new file to be found, got %v", f)
+	}
+}
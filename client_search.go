@@ -0,0 +1,240 @@
+package crocgodyl
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type SearchOptions struct {
+	Regexp        bool
+	IgnoreCase    bool
+	Include       []string
+	Exclude       []string
+	Context       int
+	MaxFileSize   int64
+	MaxTotalBytes int64
+	MaxMatches    int
+	Concurrency   int
+}
+
+type SearchMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// SearchFileError is a file that could not be read during a search, for
+// example because it was deleted in the meantime.
+type SearchFileError struct {
+	Path string `json:"path"`
+	Err  error  `json:"-"`
+}
+
+type SearchResult struct {
+	Matches       []*SearchMatch     `json:"matches"`
+	FilesSearched int                `json:"files_searched"`
+	FilesSkipped  int                `json:"files_skipped"`
+	Errors        []*SearchFileError `json:"errors,omitempty"`
+	BytesRead     int64              `json:"bytes_read"`
+	Truncated     bool               `json:"truncated"`
+}
+
+var textMimeTypes = []string{"json", "xml", "yaml", "toml", "javascript", "x-sh", "x-empty", "x-php", "x-python"}
+
+// isTextMime reports whether the mimetype Wings detected for a file looks
+// like something worth searching. An unknown type is searched and checked
+// for binary content after fetching.
+func isTextMime(mime string) bool {
+	if mime == "" || strings.HasPrefix(mime, "text/") {
+		return true
+	}
+
+	for _, t := range textMimeTypes {
+		if strings.Contains(mime, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func searchPattern(query string, opts SearchOptions) (*regexp.Regexp, error) {
+	if !opts.Regexp {
+		query = regexp.QuoteMeta(query)
+	}
+	if opts.IgnoreCase {
+		query = "(?i)" + query
+	}
+
+	return regexp.Compile(query)
+}
+
+// Search looks for query in the text files below root. Files are fetched
+// concurrently and skipped when they look binary or exceed MaxFileSize; once
+// MaxTotalBytes have been read or MaxMatches found the search stops and the
+// result is marked as truncated. Files that cannot be read are recorded in
+// the result's Errors and the search goes on.
+func (c *Client) Search(ctx context.Context, identifier, root, query string, opts SearchOptions) (*SearchResult, error) {
+	pattern, err := searchPattern(query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = 1024 * 1024
+	}
+	if opts.MaxTotalBytes <= 0 {
+		opts.MaxTotalBytes = 64 * 1024 * 1024
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Context < 0 {
+		opts.Context = 0
+	}
+
+	root = remotePath(root)
+	result := &SearchResult{Matches: []*SearchMatch{}}
+
+	var files []string
+	var budget int64
+	err = walkServerDir(ctx, c.ServerFS(identifier), root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+
+		if matchAny(opts.Exclude, p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || (len(opts.Include) > 0 && !matchAny(opts.Include, p)) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		file, _ := info.Sys().(*File)
+		if !info.Mode().IsRegular() || info.Size() > opts.MaxFileSize || (file != nil && !isTextMime(file.MimeType)) {
+			result.FilesSkipped++
+			return nil
+		}
+
+		if budget+info.Size() > opts.MaxTotalBytes {
+			result.Truncated = true
+			return fs.SkipAll
+		}
+		budget += info.Size()
+
+		files = append(files, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mu := sync.Mutex{}
+
+	queue := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range queue {
+				content, err := c.GetServerFileContents(identifier, path.Join(root, rel))
+
+				mu.Lock()
+				result.BytesRead += int64(len(content))
+				switch {
+				case err != nil:
+					result.Errors = append(result.Errors, &SearchFileError{Path: path.Join(root, rel), Err: err})
+				case !isText(content):
+					result.FilesSkipped++
+				default:
+					result.FilesSearched++
+					result.Matches = append(result.Matches, searchContent(path.Join(root, rel), string(content), pattern, opts.Context)...)
+					if opts.MaxMatches > 0 && len(result.Matches) >= opts.MaxMatches {
+						result.Truncated = true
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, rel := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- rel
+	}
+	close(queue)
+	wg.Wait()
+
+	if !result.Truncated && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		if result.Matches[i].Path != result.Matches[j].Path {
+			return result.Matches[i].Path < result.Matches[j].Path
+		}
+		return result.Matches[i].Line < result.Matches[j].Line
+	})
+	if opts.MaxMatches > 0 && len(result.Matches) > opts.MaxMatches {
+		result.Matches = result.Matches[:opts.MaxMatches]
+	}
+	sort.Slice(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Path < result.Errors[j].Path
+	})
+
+	return result, nil
+}
+
+func searchContent(name, content string, pattern *regexp.Regexp, context int) []*SearchMatch {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var matches []*SearchMatch
+	for i, line := range lines {
+		if !pattern.MatchString(line) {
+			continue
+		}
+
+		from, to := i-context, i+context+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		matches = append(matches, &SearchMatch{
+			Path:   name,
+			Line:   i + 1,
+			Text:   line,
+			Before: append([]string(nil), lines[from:i]...),
+			After:  append([]string(nil), lines[i+1:to]...),
+		})
+	}
+
+	return matches
+}
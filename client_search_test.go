@@ -0,0 +1,85 @@
+package crocgodyl
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func searchFixture(t *testing.T) *MemoryFS {
+	t.Helper()
+
+	m := NewMemoryFS()
+	m.WriteFile("server.properties", []byte("motd=hello\nmax-players=20\nonline-mode=true\n"), 0o644)
+	m.WriteFile("plugins/a/config.yml", []byte("greeting: Hello\nmax-players: 5\n"), 0o644)
+	m.WriteFile("plugins/b/config.yml", []byte("max-players: 7\n"), 0o644)
+	m.WriteFile("plugins/b.jar", []byte("PK\x03\x04\x00\x00max-players"), 0o644)
+	m.WriteFile("logs/latest.log", []byte("max-players reached\n"), 0o644)
+
+	return m
+}
+
+func TestSearch(t *testing.T) {
+	c := newTestPanel(t, searchFixture(t))
+
+	result, err := c.Search(context.Background(), "abc", "/", "MAX-PLAYERS", SearchOptions{
+		IgnoreCase: true,
+		Exclude:    []string{"logs"},
+		Context:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range result.Matches {
+		got = append(got, m.Path+":"+m.Text)
+	}
+	want := []string{
+		"/plugins/a/config.yml:max-players: 5",
+		"/plugins/b/config.yml:max-players: 7",
+		"/server.properties:max-players=20",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected matches %q", got)
+	}
+	if m := result.Matches[2]; !reflect.DeepEqual(m.Before, []string{"motd=hello"}) || !reflect.DeepEqual(m.After, []string{"online-mode=true"}) {
+		t.Fatalf("unexpected context %q %q", m.Before, m.After)
+	}
+	if result.FilesSkipped != 1 || result.FilesSearched != 3 {
+		t.Fatalf("expected the jar to be skipped, searched %d and skipped %d", result.FilesSearched, result.FilesSkipped)
+	}
+
+	if result, err = c.Search(context.Background(), "abc", "/", `max-players[:=] \d`, SearchOptions{Regexp: true, MaxMatches: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || !result.Truncated {
+		t.Fatalf("expected a single match and a truncated result, got %d, %v", len(result.Matches), result.Truncated)
+	}
+}
+
+func TestSearchRecordsUnreadableFiles(t *testing.T) {
+	c := newTestPanelWith(t, searchFixture(t), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/files/contents") && strings.HasPrefix(r.URL.Query().Get("file"), "/plugins/a/") {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors":[{"code":"AccessDeniedHttpException","status":"403","detail":"denied"}]}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	result, err := c.Search(context.Background(), "abc", "/", "max-players", SearchOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Path != "/plugins/a/config.yml" || result.Errors[0].Err == nil {
+		t.Fatalf("expected the unreadable file to be recorded, got %+v", result.Errors)
+	}
+	if len(result.Matches) != 3 {
+		t.Fatalf("expected the other files to be searched, got %d matches", len(result.Matches))
+	}
+}
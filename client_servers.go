@@ -2,14 +2,16 @@ package crocgodyl
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"time"
 )
 
@@ -188,13 +190,18 @@ func (c *Client) SetServerPowerState(identifier, state string) error {
 	body := bytes.Buffer{}
 	body.Write(data)
 
+	forget := c.noteSignal(identifier, PowerSignal(state))
+
 	req := c.newRequest("POST", fmt.Sprintf("/servers/%s/power", identifier), &body)
 	res, err := c.Http.Do(req)
 	if err != nil {
+		forget()
 		return err
 	}
 
-	_, err = validate(res)
+	if _, err = validate(res); err != nil {
+		forget()
+	}
 	return err
 }
 
@@ -318,6 +325,23 @@ type File struct {
 	ModifiedAt *time.Time `json:"modified_at,omitempty"`
 }
 
+// fileNewer reports whether a was modified after b, falling back to the
+// creation time when the modification time is unknown.
+func fileNewer(a, b *File) bool {
+	at, bt := a.ModifiedAt, b.ModifiedAt
+	if at == nil {
+		at = a.CreatedAt
+	}
+	if bt == nil {
+		bt = b.CreatedAt
+	}
+	if at == nil || bt == nil {
+		return at != nil
+	}
+
+	return at.After(*bt)
+}
+
 func (c *Client) GetServerFiles(identifier, root string) ([]*File, error) {
 	req := c.newRequest("GET", fmt.Sprintf("/servers/%s/files/list?directory=%s", identifier, url.PathEscape(root)), nil)
 	res, err := c.Http.Do(req)
@@ -360,10 +384,18 @@ func (c *Client) GetServerFileContents(identifier, file string) ([]byte, error)
 }
 
 type Downloader struct {
-	client *Client
-	Name   string
-	Path   string
-	url    string
+	client     *Client
+	identifier string
+	Name       string
+	Path       string
+	Size       int64
+	Checksum   string
+	Retries    int
+	Overwrite  bool
+	Progress   func(received, total int64)
+	url        string
+	used       bool
+	validator  string
 }
 
 func (d *Downloader) Client() *Client {
@@ -375,58 +407,61 @@ func (d *Downloader) URL() string {
 }
 
 func (d *Downloader) Execute() error {
-	info, err := os.Stat(d.Path)
-	if err == nil {
-		if !info.IsDir() {
-			return errors.New("refusing to overwrite existing file path")
-		}
-	}
+	return d.ExecuteTo(context.Background(), d.Name)
+}
 
-	res, err := d.client.Http.Get(d.URL())
+func (c *Client) DownloadServerFile(identifier, file string) (*Downloader, error) {
+	file = path.Clean("/" + file)
+	dir, name := path.Split(file)
+
+	files, err := c.GetServerFiles(identifier, dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if res.StatusCode != 200 {
-		return fmt.Errorf("recieved an unexpected response: %s", res.Status)
+	var info *File
+	for _, f := range files {
+		if f.Name == name {
+			info = f
+			break
+		}
 	}
 
-	file, err := os.OpenFile(d.Name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
+	if info == nil {
+		return nil, fmt.Errorf("file %s does not exist", file)
+	}
+	if !info.IsFile {
+		return nil, errors.New("cannot download a directory")
 	}
 
-	defer res.Body.Close()
-	io.Copy(file, res.Body)
-	return nil
-}
-
-func (c *Client) DownloadServerFile(identifier, file string) (*Downloader, error) {
-	files, err := c.GetServerFiles(identifier, "/")
+	downloadUrl, err := c.getDownloadUrl(identifier, file)
 	if err != nil {
 		return nil, err
 	}
 
-	_, name := filepath.Split(file)
-	for _, f := range files {
-		if f.Name == name {
-			if f.MimeType == "inode/directory" {
-				return nil, errors.New("cannot download a directory")
-			}
-
-			break
-		}
+	dl := &Downloader{
+		client:     c,
+		identifier: identifier,
+		Name:       name,
+		Path:       file,
+		Size:       info.Size,
+		Retries:    3,
+		url:        downloadUrl,
 	}
 
+	return dl, nil
+}
+
+func (c *Client) getDownloadUrl(identifier, file string) (string, error) {
 	req := c.newRequest("GET", fmt.Sprintf("/servers/%s/files/download?file=%s", identifier, url.PathEscape(file)), nil)
 	res, err := c.Http.Do(req)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	buf, err := validate(res)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	var model struct {
@@ -435,18 +470,10 @@ func (c *Client) DownloadServerFile(identifier, file string) (*Downloader, error
 		} `json:"attributes"`
 	}
 	if err = json.Unmarshal(buf, &model); err != nil {
-		return nil, err
-	}
-
-	path, _ := url.PathUnescape(file)
-	dl := &Downloader{
-		client: c,
-		Name:   name,
-		Path:   path,
-		url:    model.Attributes.URL,
+		return "", err
 	}
 
-	return dl, nil
+	return model.Attributes.URL, nil
 }
 
 type RenameDescriptor struct {
@@ -512,6 +539,11 @@ type CompressDescriptor struct {
 }
 
 func (c *Client) CompressServerFiles(identifier string, files CompressDescriptor) error {
+	_, err := c.compressServerFiles(identifier, files)
+	return err
+}
+
+func (c *Client) compressServerFiles(identifier string, files CompressDescriptor) ([]byte, error) {
 	data, _ := json.Marshal(files)
 	body := bytes.Buffer{}
 	body.Write(data)
@@ -519,11 +551,39 @@ func (c *Client) CompressServerFiles(identifier string, files CompressDescriptor
 	req := c.newRequest("POST", fmt.Sprintf("/servers/%s/files/compress", identifier), &body)
 	res, err := c.Http.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = validate(res)
-	return err
+	return validate(res)
+}
+
+// CompressServerFilesArchive is CompressServerFiles returning the created
+// archive. Panels that do not describe the archive in their response are
+// handled by comparing the directory listing before and after.
+func (c *Client) CompressServerFilesArchive(identifier string, files CompressDescriptor) (*File, error) {
+	before, err := c.GetServerFiles(identifier, files.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := c.compressServerFiles(identifier, files)
+	if err != nil {
+		return nil, err
+	}
+
+	var model struct {
+		Attributes *File `json:"attributes"`
+	}
+	if err = json.Unmarshal(buf, &model); err == nil && model.Attributes != nil && model.Attributes.Name != "" {
+		return model.Attributes, nil
+	}
+
+	after, err := c.GetServerFiles(identifier, files.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	return locateArchive(before, after)
 }
 
 type DecompressDescriptor struct {
@@ -632,10 +692,28 @@ func (c *Client) PullServerFile(identifier string, file PullDescriptor) error {
 	return err
 }
 
+// ErrUploadTooLarge is returned when an upload exceeds a known size limit,
+// such as Uploader.MaxSize. The client API does not expose the limit of the
+// node, so without one nothing is checked and Wings rejects the upload
+// instead.
+var ErrUploadTooLarge = errors.New("upload exceeds the node upload size limit")
+
+// Uploader sends files to a server. MaxSize is the size limit in bytes, or 0
+// for none; LimitTo sets it from a node.
 type Uploader struct {
-	client *Client
-	url    string
-	Path   string
+	client    *Client
+	url       string
+	Path      string
+	Directory string
+	MaxSize   int64
+	Progress  func(sent, total int64)
+}
+
+// LimitTo makes the uploader enforce the upload size limit of node, which
+// can be fetched through the application API.
+func (u *Uploader) LimitTo(node *Node) *Uploader {
+	u.MaxSize = node.UploadLimit()
+	return u
 }
 
 func (u *Uploader) Client() *Client {
@@ -670,17 +748,40 @@ func (u *Uploader) Execute() error {
 	}
 	defer file.Close()
 
-	body := bytes.Buffer{}
-	writer := multipart.NewWriter(&body)
-	part, _ := writer.CreateFormFile("files", info.Name())
-	io.Copy(part, file)
-	writer.Close()
+	return u.ExecuteReader(context.Background(), file, info.Name(), info.Size())
+}
+
+// ExecuteReader streams r to the server as a file called name inside
+// Directory. The size is checked against MaxSize before anything is sent;
+// pass -1 if it is unknown, in which case the limit is enforced while
+// streaming.
+func (u *Uploader) ExecuteReader(ctx context.Context, r io.Reader, name string, size int64) error {
+	if name == "" {
+		return errors.New("no file name has been specified")
+	}
+	if u.MaxSize > 0 && size > u.MaxSize {
+		return ErrUploadTooLarge
+	}
 
-	res, err := u.client.Http.Post(u.URL(), writer.FormDataContentType(), &body)
+	target, err := u.targetURL()
 	if err != nil {
 		return err
 	}
 
+	res, err := postMultipart(ctx, u.client.Http, target, func(writer *multipart.Writer) error {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(part, &progressReader{r: r, total: size, limit: u.MaxSize, progress: u.Progress})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
 	if res.StatusCode != 200 {
 		return fmt.Errorf("recieved an unexpected response: %s", res.Status)
 	}
@@ -688,6 +789,81 @@ func (u *Uploader) Execute() error {
 	return nil
 }
 
+// postMultipart streams the multipart body produced by write through a pipe,
+// so the parts never have to be held in memory.
+func postMultipart(ctx context.Context, client *http.Client, target string, write func(*multipart.Writer) error) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		if err := write(writer); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	res, err := client.Do(req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+	pr.Close()
+
+	return res, nil
+}
+
+func (u *Uploader) targetURL() (string, error) {
+	return uploadTarget(u.url, u.Directory)
+}
+
+func uploadTarget(uploadUrl, directory string) (string, error) {
+	if directory == "" {
+		return uploadUrl, nil
+	}
+
+	target, err := url.Parse(uploadUrl)
+	if err != nil {
+		return "", err
+	}
+
+	query := target.Query()
+	query.Set("directory", directory)
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	limit    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	if p.limit > 0 && p.read > p.limit {
+		return n, ErrUploadTooLarge
+	}
+	if n > 0 && p.progress != nil {
+		p.progress(p.read, p.total)
+	}
+
+	return n, err
+}
+
 func (c *Client) GetUploadUrl(identifier string) (string, error) {
 	req := c.newRequest("GET", fmt.Sprintf("/servers/%s/files/upload", identifier), nil)
 	res, err := c.Http.Do(req)
@@ -0,0 +1,506 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+type SFTPOptions struct {
+	Password        string
+	PrivateKey      []byte
+	Passphrase      []byte
+	HostKeyCallback ssh.HostKeyCallback
+	Timeout         time.Duration
+}
+
+// SFTPUsername returns the name Wings expects for SFTP logins, which is the
+// panel username followed by the short server identifier.
+func SFTPUsername(username, identifier string) string {
+	return username + "." + identifier
+}
+
+// SFTP exposes the files of a server over SFTP with the same operations as
+// ServerFS, which is better suited for large transfers.
+type SFTP struct {
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+var _ WritableFS = (*SFTP)(nil)
+
+// NewSFTP wraps an existing SFTP connection.
+func NewSFTP(client *sftp.Client) *SFTP {
+	return &SFTP{client: client}
+}
+
+// DialSFTP connects to the SFTP server of the node hosting server, logging
+// in as account with a password or private key. A HostKeyCallback is
+// required; ssh.FixedHostKey can be used to pin the key of the node.
+func DialSFTP(server *ClientServer, account *Account, opts SFTPOptions) (*SFTP, error) {
+	if opts.HostKeyCallback == nil {
+		return nil, errors.New("a host key callback is required")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	var auth []ssh.AuthMethod
+	if len(opts.PrivateKey) > 0 {
+		var signer ssh.Signer
+		var err error
+		if len(opts.Passphrase) > 0 {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(opts.PrivateKey, opts.Passphrase)
+		} else {
+			signer, err = ssh.ParsePrivateKey(opts.PrivateKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("a password or private key is required")
+	}
+
+	addr := net.JoinHostPort(server.SFTP.IP, strconv.FormatInt(server.SFTP.Port, 10))
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            SFTPUsername(account.Username, server.Identifier),
+		Auth:            auth,
+		HostKeyCallback: opts.HostKeyCallback,
+		Timeout:         opts.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &SFTP{conn: conn, client: client}, nil
+}
+
+// OpenSFTP looks up the server and the account of the client and connects
+// to the SFTP server with them.
+func (c *Client) OpenSFTP(identifier string, opts SFTPOptions) (*SFTP, error) {
+	server, err := c.GetServer(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := c.GetAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	return DialSFTP(server, account, opts)
+}
+
+func (s *SFTP) Client() *sftp.Client {
+	return s.client
+}
+
+func (s *SFTP) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func sftpError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (s *SFTP) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := s.client.Stat(remotePath(name))
+	if err != nil {
+		return nil, sftpError("stat", name, err)
+	}
+
+	return info, nil
+}
+
+func (s *SFTP) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	infos, err := s.client.ReadDir(remotePath(name))
+	if err != nil {
+		return nil, sftpError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (s *SFTP) ReadFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+
+	return io.ReadAll(f)
+}
+
+type sftpDir struct {
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *sftpDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *sftpDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *sftpDir) Close() error {
+	return nil
+}
+
+func (d *sftpDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+
+	d.offset += n
+	return rest[:n], nil
+}
+
+// Open opens a file for reading. The returned file also implements
+// io.Seeker and io.ReaderAt; directories implement fs.ReadDirFile.
+func (s *SFTP) Open(name string) (fs.File, error) {
+	info, err := s.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	if info.IsDir() {
+		entries, err := s.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &sftpDir{name: name, info: info, entries: entries}, nil
+	}
+
+	f, err := s.client.Open(remotePath(name))
+	if err != nil {
+		return nil, sftpError("open", name, err)
+	}
+
+	return f, nil
+}
+
+func (s *SFTP) Create(name string) (WritableFile, error) {
+	return s.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+func (s *SFTP) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if err := validWritePath("open", name); err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("only write access is supported")}
+	}
+
+	_, err := s.client.Stat(remotePath(name))
+	created := err != nil
+
+	f, err := s.client.OpenFile(remotePath(name), flag)
+	if err != nil {
+		return nil, sftpError("open", name, err)
+	}
+
+	if created && flag&os.O_CREATE != 0 && perm != 0 {
+		if err = f.Chmod(perm.Perm()); err != nil {
+			f.Close()
+			return nil, sftpError("chmod", name, err)
+		}
+	}
+
+	return f, nil
+}
+
+func (s *SFTP) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := s.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return sftpError("write", name, err)
+	}
+
+	return f.Close()
+}
+
+func (s *SFTP) Mkdir(name string, perm fs.FileMode) error {
+	if err := validWritePath("mkdir", name); err != nil {
+		return err
+	}
+
+	if err := s.client.Mkdir(remotePath(name)); err != nil {
+		if _, serr := s.client.Stat(remotePath(name)); serr == nil {
+			err = fs.ErrExist
+		}
+		return sftpError("mkdir", name, err)
+	}
+	if perm != 0 {
+		return s.Chmod(name, perm)
+	}
+
+	return nil
+}
+
+func (s *SFTP) MkdirAll(name string, perm fs.FileMode) error {
+	if name == "." {
+		return nil
+	}
+	if err := validWritePath("mkdir", name); err != nil {
+		return err
+	}
+
+	if err := s.client.MkdirAll(remotePath(name)); err != nil {
+		return sftpError("mkdir", name, err)
+	}
+
+	return nil
+}
+
+func (s *SFTP) Remove(name string) error {
+	if err := validWritePath("remove", name); err != nil {
+		return err
+	}
+
+	info, err := s.client.Stat(remotePath(name))
+	if err != nil {
+		return sftpError("remove", name, err)
+	}
+
+	if info.IsDir() {
+		err = s.client.RemoveDirectory(remotePath(name))
+	} else {
+		err = s.client.Remove(remotePath(name))
+	}
+	if err != nil {
+		return sftpError("remove", name, err)
+	}
+
+	return nil
+}
+
+func (s *SFTP) RemoveAll(name string) error {
+	if err := validWritePath("remove", name); err != nil {
+		return err
+	}
+
+	if _, err := s.client.Stat(remotePath(name)); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := s.client.RemoveAll(remotePath(name)); err != nil {
+		return sftpError("remove", name, err)
+	}
+
+	return nil
+}
+
+func (s *SFTP) Rename(oldname, newname string) error {
+	if err := validWritePath("rename", oldname); err != nil {
+		return err
+	}
+	if err := validWritePath("rename", newname); err != nil {
+		return err
+	}
+
+	if _, err := s.client.Stat(remotePath(newname)); err == nil {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+	}
+	if err := s.client.Rename(remotePath(oldname), remotePath(newname)); err != nil {
+		return sftpError("rename", oldname, err)
+	}
+
+	return nil
+}
+
+func (s *SFTP) Chmod(name string, mode fs.FileMode) error {
+	if err := validWritePath("chmod", name); err != nil {
+		return err
+	}
+
+	if err := s.client.Chmod(remotePath(name), mode.Perm()); err != nil {
+		return sftpError("chmod", name, err)
+	}
+
+	return nil
+}
+
+// Copy duplicates name next to itself using the naming of the panel. The
+// data passes through the client, as SFTP has no server side copy.
+func (s *SFTP) Copy(name string) error {
+	if err := validWritePath("copy", name); err != nil {
+		return err
+	}
+
+	info, err := s.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "copy", Path: name, Err: errors.New("is a directory")}
+	}
+
+	target := copyName(name, func(candidate string) bool {
+		_, err := s.client.Stat(remotePath(candidate))
+		return err == nil
+	})
+
+	src, err := s.client.Open(remotePath(name))
+	if err != nil {
+		return sftpError("copy", name, err)
+	}
+	defer src.Close()
+
+	dst, err := s.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return sftpError("copy", name, err)
+	}
+
+	return dst.Close()
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(b)
+}
+
+// Upload streams the local file to remote, creating missing directories.
+func (s *SFTP) Upload(ctx context.Context, local, remote string, progress func(sent, total int64)) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	remote = remotePath(remote)
+	if err = s.client.MkdirAll(path.Dir(remote)); err != nil {
+		return err
+	}
+
+	dst, err := s.client.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	r := &progressReader{r: &contextReader{ctx: ctx, r: src}, total: info.Size(), progress: progress}
+	if _, err = dst.ReadFrom(r); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+// Download copies remote to the local path through a ".part" file, which
+// is renamed into place once complete.
+func (s *SFTP) Download(ctx context.Context, remote, local string, progress func(received, total int64)) error {
+	src, err := s.client.Open(remotePath(remote))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	partial := local + ".part"
+	dst, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+
+	r := &progressReader{r: &contextReader{ctx: ctx, r: src}, total: info.Size(), progress: progress}
+	_, err = io.Copy(dst, r)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+
+	return os.Rename(partial, local)
+}
@@ -0,0 +1,368 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSFTPServer runs an SSH server with an in-memory SFTP subsystem on a
+// local port, accepting password logins for user.
+type testSFTPServer struct {
+	addr    *net.TCPAddr
+	hostKey ssh.PublicKey
+}
+
+func newTestSFTPServer(t *testing.T, user, password string) *testSFTPServer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if meta.User() != user || string(pass) != password {
+				return nil, errors.New("access denied")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	handlers := sftp.InMemHandler()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSFTP(conn, config, handlers)
+		}
+	}()
+
+	return &testSFTPServer{addr: l.Addr().(*net.TCPAddr), hostKey: signer.PublicKey()}
+}
+
+func serveTestSFTP(conn net.Conn, config *ssh.ServerConfig, handlers sftp.Handlers) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				go func() {
+					server := sftp.NewRequestServer(channel, handlers)
+					server.Serve()
+					server.Close()
+				}()
+			}
+		}()
+	}
+}
+
+func (s *testSFTPServer) dial(t *testing.T, password string) *SFTP {
+	t.Helper()
+
+	server := &ClientServer{Identifier: "abcd1234"}
+	server.SFTP.IP = s.addr.IP.String()
+	server.SFTP.Port = int64(s.addr.Port)
+
+	client, err := DialSFTP(server, &Account{Username: "admin"}, SFTPOptions{
+		Password:        password,
+		HostKeyCallback: ssh.FixedHostKey(s.hostKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestDialSFTP(t *testing.T) {
+	srv := newTestSFTPServer(t, "admin.abcd1234", "secret")
+
+	server := &ClientServer{Identifier: "abcd1234"}
+	server.SFTP.IP = srv.addr.IP.String()
+	server.SFTP.Port = int64(srv.addr.Port)
+	account := &Account{Username: "admin"}
+
+	if _, err := DialSFTP(server, account, SFTPOptions{Password: "secret"}); err == nil {
+		t.Fatal("expected an error without a host key callback")
+	}
+	if _, err := DialSFTP(server, account, SFTPOptions{HostKeyCallback: ssh.FixedHostKey(srv.hostKey)}); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+	if _, err := DialSFTP(server, account, SFTPOptions{
+		Password:        "wrong",
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey),
+	}); err == nil {
+		t.Fatal("expected the login to fail with a wrong password")
+	}
+
+	client := srv.dial(t, "secret")
+	if _, err := client.Stat("."); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenSFTP(t *testing.T) {
+	srv := newTestSFTPServer(t, "admin.abcd1234", "secret")
+
+	panel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/client/servers/abcd1234":
+			json.NewEncoder(w).Encode(map[string]interface{}{"attributes": map[string]interface{}{
+				"identifier": "abcd1234",
+				"sftp_details": map[string]interface{}{
+					"ip":   srv.addr.IP.String(),
+					"port": srv.addr.Port,
+				},
+			}})
+		case "/api/client/account":
+			json.NewEncoder(w).Encode(map[string]interface{}{"attributes": map[string]interface{}{
+				"username": "admin",
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":"NotFoundHttpException","status":"404","detail":"not found"}]}`))
+		}
+	}))
+	defer panel.Close()
+
+	c, err := NewClient(panel.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := c.OpenSFTP("abcd1234", SFTPOptions{Password: "secret", HostKeyCallback: ssh.FixedHostKey(srv.hostKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err = client.WriteFile("hello.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.OpenSFTP("missing", SFTPOptions{Password: "secret", HostKeyCallback: ssh.FixedHostKey(srv.hostKey)}); !isNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestSFTPWritableFS(t *testing.T) {
+	srv := newTestSFTPServer(t, "admin.abcd1234", "secret")
+	client := srv.dial(t, "secret")
+
+	if err := client.MkdirAll("config/plugins", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.MkdirAll("config/plugins", 0o755); err != nil {
+		t.Fatalf("MkdirAll on an existing directory: %v", err)
+	}
+	if err := client.Mkdir("config", 0); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist from Mkdir, got %v", err)
+	}
+
+	if err := client.WriteFile("config/server.properties", []byte("motd=hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := client.ReadFile("config/server.properties")
+	if err != nil || string(b) != "motd=hi\n" {
+		t.Fatalf("unexpected contents %q, %v", b, err)
+	}
+	if _, err = client.ReadFile("config"); err == nil {
+		t.Fatal("expected an error reading a directory")
+	}
+	if _, err = client.ReadFile("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+
+	f, err := client.Create("config/server.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("motd=bye\n"))
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = client.ReadFile("config/server.properties"); string(b) != "motd=bye\n" {
+		t.Fatalf("Create did not truncate, got %q", b)
+	}
+	if _, err = client.OpenFile("config/server.properties", os.O_RDONLY, 0); err == nil {
+		t.Fatal("expected OpenFile to refuse read-only access")
+	}
+
+	if err = client.Copy("config/server.properties"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Copy("config/server.properties"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := client.ReadDir("config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"plugins", "server copy 1.properties", "server copy.properties", "server.properties"}
+	if len(names) != len(want) {
+		t.Fatalf("unexpected entries %q", names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("unexpected entries %q", names)
+		}
+	}
+
+	if err = client.Rename("config/server copy.properties", "config/server.properties"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist when renaming onto an existing file, got %v", err)
+	}
+	if err = client.Rename("config/server copy.properties", "config/old.properties"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Stat("config/old.properties"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.Chmod("config/old.properties", 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.Remove("config/old.properties"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Stat("config/old.properties"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist after Remove, got %v", err)
+	}
+	if err = client.Remove("config/plugins"); err != nil {
+		t.Fatalf("Remove on an empty directory: %v", err)
+	}
+
+	if err = client.RemoveAll("config"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.RemoveAll("config"); err != nil {
+		t.Fatalf("RemoveAll on a missing path: %v", err)
+	}
+	if _, err = client.Stat("config"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist after RemoveAll, got %v", err)
+	}
+
+	if err = client.WriteFile("../escape.txt", nil, 0o644); err == nil {
+		t.Fatal("expected an invalid path to be rejected")
+	}
+}
+
+func TestSFTPUploadDownload(t *testing.T) {
+	srv := newTestSFTPServer(t, "admin.abcd1234", "secret")
+	client := srv.dial(t, "secret")
+	dir := t.TempDir()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64<<10)
+	local := filepath.Join(dir, "world.zip")
+	if err := os.WriteFile(local, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent, total int64
+	err := client.Upload(context.Background(), local, "backups/2024/world.zip", func(n, t int64) {
+		sent, total = n, t
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != int64(len(data)) || total != int64(len(data)) {
+		t.Fatalf("unexpected upload progress %d/%d", sent, total)
+	}
+
+	info, err := client.Stat("backups/2024/world.zip")
+	if err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("unexpected uploaded file %v, %v", info, err)
+	}
+
+	downloaded := filepath.Join(dir, "downloaded.zip")
+	var received int64
+	err = client.Download(context.Background(), "backups/2024/world.zip", downloaded, func(n, _ int64) {
+		received = n
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != int64(len(data)) {
+		t.Fatalf("unexpected download progress %d", received)
+	}
+
+	b, err := os.ReadFile(downloaded)
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("downloaded file differs (%d bytes), %v", len(b), err)
+	}
+	if _, err = os.Stat(downloaded + ".part"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("the partial file was left behind")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = client.Download(ctx, "backups/2024/world.zip", filepath.Join(dir, "cancelled.zip"), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled download, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "cancelled.zip.part")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("the partial file of a cancelled download was left behind")
+	}
+	if err = client.Upload(ctx, local, "cancelled.zip", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled upload, got %v", err)
+	}
+
+	if err = client.Download(context.Background(), "missing.zip", filepath.Join(dir, "missing.zip"), nil); err == nil {
+		t.Fatal("expected an error downloading a missing file")
+	}
+}
@@ -0,0 +1,260 @@
+package crocgodyl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+type StatsSample struct {
+	Time             time.Time     `json:"time"`
+	State            ServerState   `json:"state"`
+	MemoryLimitBytes int64         `json:"memory_limit_bytes"`
+	Usage            ResourceUsage `json:"usage"`
+}
+
+// ParseStatsEvent decodes the payload of a "stats" console event. Wings nests
+// the network counters, so they are flattened into ResourceUsage here.
+func ParseStatsEvent(ev *ConsoleEvent) (*StatsSample, error) {
+	if ev.Event != EventStats {
+		return nil, errors.New("not a stats event: " + ev.Event)
+	}
+	if len(ev.Args) == 0 {
+		return nil, errors.New("stats event has no payload")
+	}
+
+	var model struct {
+		MemoryBytes      int64       `json:"memory_bytes"`
+		MemoryLimitBytes int64       `json:"memory_limit_bytes"`
+		CPUAbsolute      float64     `json:"cpu_absolute"`
+		DiskBytes        int64       `json:"disk_bytes"`
+		State            ServerState `json:"state"`
+		Uptime           int64       `json:"uptime"`
+		Network          struct {
+			RxBytes int64 `json:"rx_bytes"`
+			TxBytes int64 `json:"tx_bytes"`
+		} `json:"network"`
+	}
+	if err := json.Unmarshal([]byte(ev.Args[0]), &model); err != nil {
+		return nil, err
+	}
+
+	return &StatsSample{
+		Time:             time.Now(),
+		State:            model.State,
+		MemoryLimitBytes: model.MemoryLimitBytes,
+		Usage: ResourceUsage{
+			MemoryBytes:    model.MemoryBytes,
+			DiskBytes:      model.DiskBytes,
+			CPUAbsolute:    model.CPUAbsolute,
+			NetworkRxBytes: model.Network.RxBytes,
+			NetworkTxBytes: model.Network.TxBytes,
+			Uptime:         model.Uptime,
+		},
+	}, nil
+}
+
+// Stats streams decoded stats samples until ctx is done or the console
+// closes. Malformed payloads are skipped.
+func (c *Console) Stats(ctx context.Context) <-chan *StatsSample {
+	out := make(chan *StatsSample)
+	events, cancel := c.Subscribe()
+
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if ev.Event != EventStats {
+					continue
+				}
+
+				sample, err := ParseStatsEvent(ev)
+				if err != nil {
+					continue
+				}
+
+				select {
+				case out <- sample:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+type Aggregate struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+	P95 float64 `json:"p95"`
+}
+
+func aggregate(values []float64) Aggregate {
+	if len(values) == 0 {
+		return Aggregate{}
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return Aggregate{
+		Min: sorted[0],
+		Max: sorted[len(sorted)-1],
+		Avg: sum / float64(len(sorted)),
+		P95: sorted[rank],
+	}
+}
+
+type StatsSummary struct {
+	Window        time.Duration `json:"window"`
+	Samples       int           `json:"samples"`
+	CPU           Aggregate     `json:"cpu"`
+	Memory        Aggregate     `json:"memory"`
+	NetworkRxRate float64       `json:"network_rx_rate"`
+	NetworkTxRate float64       `json:"network_tx_rate"`
+	Latest        *StatsSample  `json:"latest,omitempty"`
+}
+
+// StatsAggregator keeps samples for the longest configured window and
+// summarises them on demand. Network rates are in bytes per second and
+// derived from the counters, ignoring drops caused by container restarts.
+type StatsAggregator struct {
+	windows []time.Duration
+	retain  time.Duration
+
+	mu      sync.Mutex
+	samples []*StatsSample
+}
+
+func NewStatsAggregator(windows ...time.Duration) *StatsAggregator {
+	if len(windows) == 0 {
+		windows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+	}
+
+	agg := &StatsAggregator{windows: windows}
+	for _, w := range windows {
+		if w > agg.retain {
+			agg.retain = w
+		}
+	}
+
+	return agg
+}
+
+func (a *StatsAggregator) Add(sample *StatsSample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.samples = append(a.samples, sample)
+
+	cutoff := sample.Time.Add(-a.retain)
+	drop := 0
+	for drop < len(a.samples) && a.samples[drop].Time.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		a.samples = append(a.samples[:0], a.samples[drop:]...)
+	}
+}
+
+// Run feeds every sample from the console into the aggregator until ctx is
+// done or the console closes.
+func (a *StatsAggregator) Run(ctx context.Context, con *Console) error {
+	for sample := range con.Stats(ctx) {
+		a.Add(sample)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return con.Err()
+}
+
+func (a *StatsAggregator) Summary(window time.Duration) StatsSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	summary := StatsSummary{Window: window}
+	if len(a.samples) == 0 {
+		return summary
+	}
+
+	last := a.samples[len(a.samples)-1]
+	cutoff := last.Time.Add(-window)
+
+	start := len(a.samples) - 1
+	for start > 0 && !a.samples[start-1].Time.Before(cutoff) {
+		start--
+	}
+	samples := a.samples[start:]
+
+	cpu := make([]float64, 0, len(samples))
+	mem := make([]float64, 0, len(samples))
+	var rx, tx int64
+	for i, s := range samples {
+		cpu = append(cpu, s.Usage.CPUAbsolute)
+		mem = append(mem, float64(s.Usage.MemoryBytes))
+
+		if i > 0 {
+			rx += counterDelta(samples[i-1].Usage.NetworkRxBytes, s.Usage.NetworkRxBytes)
+			tx += counterDelta(samples[i-1].Usage.NetworkTxBytes, s.Usage.NetworkTxBytes)
+		}
+	}
+
+	summary.Samples = len(samples)
+	summary.CPU = aggregate(cpu)
+	summary.Memory = aggregate(mem)
+	summary.Latest = last
+
+	if elapsed := last.Time.Sub(samples[0].Time).Seconds(); elapsed > 0 {
+		summary.NetworkRxRate = float64(rx) / elapsed
+		summary.NetworkTxRate = float64(tx) / elapsed
+	}
+
+	return summary
+}
+
+func (a *StatsAggregator) Summaries() []StatsSummary {
+	summaries := make([]StatsSummary, 0, len(a.windows))
+	for _, w := range a.windows {
+		summaries = append(summaries, a.Summary(w))
+	}
+
+	return summaries
+}
+
+func counterDelta(prev, next int64) int64 {
+	if next < prev {
+		return next
+	}
+
+	return next - prev
+}
@@ -0,0 +1,140 @@
+package crocgodyl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	values := make([]float64, 0, 20)
+	for i := 20; i >= 1; i-- {
+		values = append(values, float64(i))
+	}
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   Aggregate
+	}{
+		{name: "empty", want: Aggregate{}},
+		{name: "single", values: []float64{4}, want: Aggregate{Min: 4, Max: 4, Avg: 4, P95: 4}},
+		{name: "unsorted", values: []float64{3, 1, 2}, want: Aggregate{Min: 1, Max: 3, Avg: 2, P95: 3}},
+		{name: "twenty", values: values, want: Aggregate{Min: 1, Max: 20, Avg: 10.5, P95: 19}},
+	}
+
+	for _, tt := range tests {
+		if got := aggregate(tt.values); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if values[0] != 20 {
+		t.Fatal("aggregate sorted its input")
+	}
+}
+
+// statsAt builds a sample taken the given number of seconds after start.
+func statsAt(start time.Time, seconds int, cpu float64, memory, rx, tx int64) *StatsSample {
+	return &StatsSample{
+		Time:  start.Add(time.Duration(seconds) * time.Second),
+		State: StateRunning,
+		Usage: ResourceUsage{CPUAbsolute: cpu, MemoryBytes: memory, NetworkRxBytes: rx, NetworkTxBytes: tx},
+	}
+}
+
+func TestStatsAggregatorSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	agg := NewStatsAggregator(10*time.Second, time.Minute)
+
+	agg.Add(statsAt(start, 0, 10, 100, 0, 0))
+	agg.Add(statsAt(start, 20, 50, 300, 1000, 200))
+	agg.Add(statsAt(start, 30, 30, 200, 3000, 400))
+	agg.Add(statsAt(start, 40, 20, 400, 4000, 1000))
+
+	short := agg.Summary(10 * time.Second)
+	if short.Samples != 2 || short.CPU != (Aggregate{Min: 20, Max: 30, Avg: 25, P95: 30}) {
+		t.Fatalf("unexpected short summary %+v", short)
+	}
+	if short.NetworkRxRate != 100 || short.NetworkTxRate != 60 {
+		t.Fatalf("unexpected short rates %v, %v", short.NetworkRxRate, short.NetworkTxRate)
+	}
+
+	long := agg.Summary(time.Minute)
+	if long.Samples != 4 || long.Memory != (Aggregate{Min: 100, Max: 400, Avg: 250, P95: 400}) {
+		t.Fatalf("unexpected long summary %+v", long)
+	}
+	if long.NetworkRxRate != 100 || long.NetworkTxRate != 25 {
+		t.Fatalf("unexpected long rates %v, %v", long.NetworkRxRate, long.NetworkTxRate)
+	}
+	if long.Latest == nil || long.Latest.Usage.CPUAbsolute != 20 {
+		t.Fatalf("unexpected latest sample %+v", long.Latest)
+	}
+
+	if got := agg.Summaries(); len(got) != 2 || got[0].Window != 10*time.Second || got[1].Window != time.Minute {
+		t.Fatalf("unexpected summaries %+v", got)
+	}
+}
+
+func TestStatsAggregatorCounterReset(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	agg := NewStatsAggregator(time.Minute)
+
+	agg.Add(statsAt(start, 0, 0, 0, 5000, 5000))
+	agg.Add(statsAt(start, 10, 0, 0, 6000, 5500))
+	// The container restarted, so the counters start over from zero.
+	agg.Add(statsAt(start, 20, 0, 0, 400, 100))
+	agg.Add(statsAt(start, 30, 0, 0, 1400, 600))
+
+	// 1000 + 400 + 1000 bytes received and 500 + 100 + 500 sent in 30s.
+	summary := agg.Summary(time.Minute)
+	if summary.NetworkRxRate != 80 || summary.NetworkTxRate != 1100.0/30 {
+		t.Fatalf("unexpected rates %v, %v", summary.NetworkRxRate, summary.NetworkTxRate)
+	}
+}
+
+func TestStatsAggregatorRetention(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	agg := NewStatsAggregator(time.Minute)
+
+	if summary := agg.Summary(time.Minute); summary.Samples != 0 || summary.Latest != nil {
+		t.Fatalf("expected an empty summary, got %+v", summary)
+	}
+
+	for i := 0; i <= 120; i += 10 {
+		agg.Add(statsAt(start, i, float64(i), 0, 0, 0))
+	}
+
+	// Samples older than the longest window are dropped, so even a longer
+	// window only sees the last minute.
+	summary := agg.Summary(time.Hour)
+	if summary.Samples != 7 || summary.CPU.Min != 60 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	// A single sample has no rate.
+	if summary = agg.Summary(0); summary.Samples != 1 || summary.NetworkRxRate != 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestParseStatsEvent(t *testing.T) {
+	ev := &ConsoleEvent{Event: EventStats, Args: []string{`{"memory_bytes":100,"memory_limit_bytes":200,"cpu_absolute":12.5,"disk_bytes":300,"state":"running","uptime":60,"network":{"rx_bytes":10,"tx_bytes":20}}`}}
+
+	sample, err := ParseStatsEvent(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ResourceUsage{MemoryBytes: 100, DiskBytes: 300, CPUAbsolute: 12.5, NetworkRxBytes: 10, NetworkTxBytes: 20, Uptime: 60}
+	if sample.Usage != want || sample.State != StateRunning || sample.MemoryLimitBytes != 200 {
+		t.Fatalf("unexpected sample %+v", sample)
+	}
+
+	for _, ev := range []*ConsoleEvent{
+		{Event: EventConsoleOutput, Args: []string{"{}"}},
+		{Event: EventStats},
+		{Event: EventStats, Args: []string{"{"}},
+	} {
+		if _, err = ParseStatsEvent(ev); err == nil {
+			t.Errorf("expected %+v to be rejected", ev)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package crocgodyl
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RestartPolicy limits restarts to MaxRestarts within Window, or overall
+// when Window is zero. A negative MaxRestarts never gives up and zero allows
+// DefaultMaxRestarts. The delay before each restart starts at Backoff and
+// doubles per attempt, capped at MaxBackoff.
+type RestartPolicy struct {
+	MaxRestarts int
+	Window      time.Duration
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+const DefaultMaxRestarts = 3
+
+func (p RestartPolicy) maxRestarts() int {
+	if p.MaxRestarts == 0 {
+		return DefaultMaxRestarts
+	}
+
+	return p.MaxRestarts
+}
+
+func (p RestartPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d > 0; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return d
+}
+
+type CrashReport struct {
+	Identifier string    `json:"identifier"`
+	Time       time.Time `json:"time"`
+	Lines      []string  `json:"lines"`
+	Restarts   int       `json:"restarts"`
+	GaveUp     bool      `json:"gave_up"`
+}
+
+// Supervisor watches servers for unexpected running -> offline transitions,
+// which Wings reports when a process exits without being asked to stop, and
+// restarts them according to Policy. Transitions following a stop, kill or
+// restart signal sent through Client are not crashes. Status changes are read from the
+// console, or polled with GetServerResources when the socket is unavailable.
+type Supervisor struct {
+	Client       *Client
+	Policy       RestartPolicy
+	ConsoleLines int
+
+	OnCrash   func(*CrashReport)
+	OnRestart func(identifier string, attempt int, err error)
+	OnGiveUp  func(*CrashReport)
+
+	mu      sync.Mutex
+	watches map[string]context.CancelFunc
+}
+
+func NewSupervisor(client *Client, policy RestartPolicy) *Supervisor {
+	return &Supervisor{
+		Client:       client,
+		Policy:       policy,
+		ConsoleLines: 100,
+		watches:      map[string]context.CancelFunc{},
+	}
+}
+
+// Start watches the server in the background until Stop is called for it or
+// ctx is done.
+func (s *Supervisor) Start(ctx context.Context, identifier string) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	if s.watches == nil {
+		s.watches = map[string]context.CancelFunc{}
+	}
+	if prev, ok := s.watches[identifier]; ok {
+		prev()
+	}
+	s.watches[identifier] = cancel
+	s.mu.Unlock()
+
+	go s.Watch(ctx, identifier)
+}
+
+func (s *Supervisor) Stop(identifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, ok := s.watches[identifier]; ok {
+		cancel()
+		delete(s.watches, identifier)
+	}
+}
+
+func (s *Supervisor) StopAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, cancel := range s.watches {
+		cancel()
+		delete(s.watches, id)
+	}
+}
+
+type watchState struct {
+	identifier string
+	state      ServerState
+	upSince    time.Time
+	lines      []string
+	restarts   []time.Time
+}
+
+func (w *watchState) addLine(line string, max int) {
+	if max <= 0 {
+		return
+	}
+
+	w.lines = append(w.lines, line)
+	if len(w.lines) > max {
+		w.lines = append(w.lines[:0], w.lines[len(w.lines)-max:]...)
+	}
+}
+
+// Watch blocks, supervising a single server until ctx is done.
+func (s *Supervisor) Watch(ctx context.Context, identifier string) error {
+	w := &watchState{identifier: identifier, upSince: time.Now()}
+
+	for ctx.Err() == nil {
+		con, err := s.Client.OpenConsole(ctx, identifier)
+		if err == nil {
+			s.watchConsole(ctx, con, w)
+			con.Close()
+		} else if res, err := s.Client.GetServerResources(identifier); err == nil {
+			s.transition(ctx, w, ServerState(res.State))
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(StatePollInterval):
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (s *Supervisor) watchConsole(ctx context.Context, con *Console, w *watchState) {
+	events, cancel := con.Subscribe()
+	defer cancel()
+
+	if res, err := s.Client.GetServerResources(w.identifier); err == nil {
+		s.transition(ctx, w, ServerState(res.State))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+
+			switch ev.Event {
+			case EventConsoleOutput:
+				for _, line := range ev.Args {
+					w.addLine(line, s.ConsoleLines)
+				}
+			case EventStatus:
+				if len(ev.Args) > 0 {
+					s.transition(ctx, w, ServerState(ev.Args[0]))
+				}
+			}
+		}
+	}
+}
+
+func (s *Supervisor) transition(ctx context.Context, w *watchState, next ServerState) {
+	prev := w.state
+	w.state = next
+
+	now := time.Now()
+	if prev != "" && next.In(StateStarting, StateRunning) && !prev.In(StateStarting, StateRunning) {
+		w.upSince = now
+	}
+	if prev != StateRunning || next != StateOffline {
+		return
+	}
+	if s.Client.lastStop(w.identifier).After(w.upSince) {
+		return
+	}
+
+	if s.Policy.Window > 0 {
+		cutoff := now.Add(-s.Policy.Window)
+		kept := w.restarts[:0]
+		for _, t := range w.restarts {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		w.restarts = kept
+	}
+
+	report := &CrashReport{
+		Identifier: w.identifier,
+		Time:       now,
+		Lines:      append([]string(nil), w.lines...),
+		Restarts:   len(w.restarts),
+	}
+	w.lines = w.lines[:0]
+
+	if s.OnCrash != nil {
+		s.OnCrash(report)
+	}
+
+	if max := s.Policy.maxRestarts(); max >= 0 && len(w.restarts) >= max {
+		report.GaveUp = true
+		if s.OnGiveUp != nil {
+			s.OnGiveUp(report)
+		}
+		return
+	}
+
+	attempt := len(w.restarts) + 1
+	w.restarts = append(w.restarts, now)
+
+	go func() {
+		if d := s.Policy.delay(attempt); d > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d):
+			}
+		}
+
+		err := s.Client.SendPowerSignal(w.identifier, PowerStart)
+		if s.OnRestart != nil {
+			s.OnRestart(w.identifier, attempt, err)
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+package crocgodyl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// superviseFake starts supervising the fake server and returns once the
+// supervisor is subscribed to its console.
+func superviseFake(t *testing.T, f *fakeWings, sv *Supervisor) {
+	t.Helper()
+
+	watching := make(chan struct{}, 1)
+	f.mu.Lock()
+	f.onResources = func() {
+		select {
+		case watching <- struct{}{}:
+		default:
+		}
+	}
+	f.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	sv.Start(ctx, "abc")
+
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the supervisor did not start watching")
+	}
+}
+
+func TestSupervisorRestartsCrashes(t *testing.T) {
+	f := newFakeWings(t, "running")
+	f.onSignal = func(signal string) {
+		// Reported before the request returns, as Wings may.
+		if signal == string(PowerStart) {
+			f.setState("starting")
+			f.setState("running")
+		}
+	}
+
+	restarts := make(chan int, 10)
+	gaveUp := make(chan *CrashReport, 1)
+	sv := NewSupervisor(f.client, RestartPolicy{})
+	sv.OnRestart = func(_ string, attempt int, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		restarts <- attempt
+	}
+	sv.OnGiveUp = func(r *CrashReport) { gaveUp <- r }
+	superviseFake(t, f, sv)
+
+	// The zero policy allows DefaultMaxRestarts restarts.
+	for i := 1; i <= DefaultMaxRestarts; i++ {
+		f.emit(EventConsoleOutput, "crashing")
+		f.setState("offline")
+
+		select {
+		case attempt := <-restarts:
+			if attempt != i {
+				t.Fatalf("expected attempt %d, got %d", i, attempt)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("crash %d was not restarted", i)
+		}
+	}
+
+	f.setState("offline")
+	select {
+	case r := <-gaveUp:
+		if r.Restarts != DefaultMaxRestarts || !r.GaveUp {
+			t.Fatalf("unexpected report %+v", r)
+		}
+		if len(r.Lines) != 0 {
+			t.Fatalf("expected only the lines since the last crash, got %q", r.Lines)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the supervisor did not give up")
+	}
+}
+
+func TestSupervisorIgnoresRequestedStops(t *testing.T) {
+	f := newFakeWings(t, "running")
+	f.onSignal = func(signal string) {
+		if signal == string(PowerKill) {
+			f.setState("offline")
+		}
+	}
+
+	crashes := make(chan *CrashReport, 10)
+	restarts := make(chan int, 10)
+	sv := NewSupervisor(f.client, RestartPolicy{MaxRestarts: -1})
+	sv.OnCrash = func(r *CrashReport) { crashes <- r }
+	sv.OnRestart = func(_ string, attempt int, _ error) { restarts <- attempt }
+	superviseFake(t, f, sv)
+
+	if err := f.client.SendPowerSignal("abc", PowerKill); err != nil {
+		t.Fatal(err)
+	}
+
+	// Started again from outside the client, then crashing for real.
+	f.setState("starting")
+	f.setState("running")
+	f.setState("offline")
+
+	select {
+	case <-restarts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the crash after the kill was not restarted")
+	}
+	if n := len(crashes); n != 1 {
+		t.Fatalf("expected only the real crash to be reported, got %d", n)
+	}
+	if got := f.sentSignals(); strings.Join(got, ",") != "kill,start" {
+		t.Fatalf("unexpected signals %q", got)
+	}
+}
+
+func TestRestartPolicyDelay(t *testing.T) {
+	p := RestartPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if got := p.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
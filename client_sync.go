@@ -0,0 +1,362 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SyncOptions struct {
+	Delete      bool
+	Checksum    bool
+	Include     []string
+	Exclude     []string
+	DryRun      bool
+	Concurrency int
+}
+
+func (o *SyncOptions) selected(rel string, dir bool) bool {
+	if matchAny(o.Exclude, rel) {
+		return false
+	}
+	if dir || len(o.Include) == 0 {
+		return true
+	}
+
+	return matchAny(o.Include, rel)
+}
+
+type SyncAction string
+
+const (
+	SyncMkdir  SyncAction = "mkdir"
+	SyncUpload SyncAction = "upload"
+	SyncDelete SyncAction = "delete"
+	// SyncSkip marks a file that could not be compared. Its Err says why,
+	// and Sync leaves it alone.
+	SyncSkip SyncAction = "skip"
+)
+
+type SyncOp struct {
+	Action SyncAction `json:"action"`
+	Path   string     `json:"path"`
+	Reason string     `json:"reason,omitempty"`
+	Size   int64      `json:"size,omitempty"`
+	Err    error      `json:"-"`
+}
+
+type SyncPlan struct {
+	Local  string    `json:"local"`
+	Remote string    `json:"remote"`
+	Ops    []*SyncOp `json:"ops"`
+}
+
+func (p *SyncPlan) String() string {
+	sb := &strings.Builder{}
+	for _, op := range p.Ops {
+		sb.WriteString(fmt.Sprintf("%-6s %s", op.Action, op.Path))
+		if op.Reason != "" {
+			sb.WriteString(" (" + op.Reason + ")")
+		}
+		if op.Err != nil {
+			sb.WriteString(": " + op.Err.Error())
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func (p *SyncPlan) Err() error {
+	var errs []error
+	for _, op := range p.Ops {
+		if op.Err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", op.Action, op.Path, op.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type syncEntry struct {
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+// PlanSync compares the local directory against remote and returns the
+// operations Sync would perform, without changing anything.
+func (c *Client) PlanSync(ctx context.Context, identifier, local, remote string, opts SyncOptions) (*SyncPlan, error) {
+	remote = remotePath(remote)
+	plan := &SyncPlan{Local: local, Remote: remote}
+
+	locals := map[string]syncEntry{}
+	err := filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !opts.selected(rel, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		locals[rel] = syncEntry{dir: d.IsDir(), size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := map[string]syncEntry{}
+	err = walkServerDir(ctx, c.ServerFS(identifier), remote, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+
+		if matchAny(opts.Exclude, p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		remotes[p] = syncEntry{dir: d.IsDir(), size: info.Size(), modTime: info.ModTime()}
+
+		// Directories missing locally are deleted as a whole, unless only
+		// some of the files in them are selected.
+		if _, ok := locals[p]; !ok && d.IsDir() && len(opts.Include) == 0 {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(locals))
+	// With Include set, only directories leading to selected files are
+	// created remotely.
+	needed := map[string]bool{}
+	for name, l := range locals {
+		names = append(names, name)
+		if !l.dir {
+			for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+				needed[dir] = true
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		l := locals[name]
+		r, exists := remotes[name]
+
+		if l.dir {
+			if (!exists || !r.dir) && (len(opts.Include) == 0 || needed[name]) {
+				plan.Ops = append(plan.Ops, &SyncOp{Action: SyncMkdir, Path: name})
+			}
+			continue
+		}
+
+		reason, err := c.syncReason(ctx, identifier, path.Join(remote, name), filepath.Join(local, filepath.FromSlash(name)), l, r, exists, opts.Checksum)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			plan.Ops = append(plan.Ops, &SyncOp{Action: SyncSkip, Path: name, Reason: "cannot compare", Size: l.size, Err: err})
+			continue
+		}
+		if reason != "" {
+			plan.Ops = append(plan.Ops, &SyncOp{Action: SyncUpload, Path: name, Reason: reason, Size: l.size})
+		}
+	}
+
+	if opts.Delete {
+		extra := make([]string, 0)
+		for name := range remotes {
+			if _, ok := locals[name]; ok || !opts.selected(name, remotes[name].dir) {
+				continue
+			}
+			// Directories may hold files that are not selected.
+			if remotes[name].dir && len(opts.Include) > 0 {
+				continue
+			}
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+
+		for _, name := range extra {
+			plan.Ops = append(plan.Ops, &SyncOp{Action: SyncDelete, Path: name, Reason: "not present locally"})
+		}
+	}
+
+	return plan, nil
+}
+
+func (c *Client) syncReason(ctx context.Context, identifier, remote, local string, l, r syncEntry, exists, checksum bool) (string, error) {
+	switch {
+	case !exists:
+		return "new file", nil
+	case r.dir:
+		return "replaces a directory", nil
+	case l.size != r.size:
+		return "size changed", nil
+	case !checksum:
+		if l.modTime.After(r.modTime) {
+			return "modified", nil
+		}
+		return "", nil
+	}
+
+	file, err := os.Open(local)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	localSum := sha256.New()
+	if _, err = io.Copy(localSum, file); err != nil {
+		return "", err
+	}
+
+	// The contents endpoint refuses files above the edit size limit of the
+	// panel, so the remote file is hashed through a download instead.
+	downloadUrl, err := c.getDownloadUrl(identifier, remote)
+	if err != nil {
+		return "", err
+	}
+	dl := &Downloader{client: c, identifier: identifier, Name: path.Base(remote), Path: remote, Size: r.size, Retries: 3, url: downloadUrl}
+
+	remoteSum := sha256.New()
+	if _, err = dl.ExecuteWriter(ctx, remoteSum); err != nil {
+		return "", err
+	}
+
+	if !bytes.Equal(localSum.Sum(nil), remoteSum.Sum(nil)) {
+		return "content changed", nil
+	}
+
+	return "", nil
+}
+
+// Sync makes remote match the local directory: missing folders are created,
+// new and changed files uploaded and, with Delete set, files missing locally
+// removed. With DryRun set only the plan is returned. Errors of individual
+// operations, including files that could not be compared, are recorded on
+// the plan; see SyncPlan.Err.
+func (c *Client) Sync(ctx context.Context, identifier, local, remote string, opts SyncOptions) (*SyncPlan, error) {
+	plan, err := c.PlanSync(ctx, identifier, local, remote, opts)
+	if err != nil || opts.DryRun {
+		return plan, err
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	remote = plan.Remote
+
+	if remote != "/" {
+		dir, name := path.Split(remote)
+		if err = c.CreateServerFileFolder(identifier, CreateFolderDescriptor{Root: dir, Name: name}); err != nil {
+			return plan, err
+		}
+	}
+
+	var uploads, deletes []*SyncOp
+	for _, op := range plan.Ops {
+		switch op.Action {
+		case SyncMkdir:
+			dir, name := path.Split(path.Join(remote, op.Path))
+			op.Err = c.CreateServerFileFolder(identifier, CreateFolderDescriptor{Root: dir, Name: name})
+		case SyncUpload:
+			uploads = append(uploads, op)
+		case SyncDelete:
+			deletes = append(deletes, op)
+		}
+	}
+
+	queue := make(chan *SyncOp)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for op := range queue {
+				target := path.Join(remote, op.Path)
+				f := &uploadFile{
+					local:  filepath.Join(local, filepath.FromSlash(op.Path)),
+					rel:    op.Path,
+					remote: target,
+					size:   op.Size,
+				}
+				batch := &uploadBatch{directory: path.Dir(target), files: []*uploadFile{f}}
+				op.Err = c.sendUploadBatch(ctx, identifier, batch, func(int64) {})
+			}
+		}()
+	}
+
+	for _, op := range uploads {
+		if ctx.Err() != nil {
+			op.Err = ctx.Err()
+			continue
+		}
+		queue <- op
+	}
+	close(queue)
+	wg.Wait()
+
+	byDir := map[string][]*SyncOp{}
+	for _, op := range deletes {
+		dir := path.Dir(path.Join(remote, op.Path))
+		byDir[dir] = append(byDir[dir], op)
+	}
+	for dir, ops := range byDir {
+		files := make([]string, 0, len(ops))
+		for _, op := range ops {
+			files = append(files, path.Base(op.Path))
+		}
+
+		err := c.DeleteServerFiles(identifier, DeleteFilesDescriptor{Root: dir, Files: files})
+		for _, op := range ops {
+			op.Err = err
+		}
+	}
+
+	return plan, ctx.Err()
+}
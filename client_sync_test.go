@@ -0,0 +1,115 @@
+package crocgodyl
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeLocalTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func planOps(plan *SyncPlan) []string {
+	var ops []string
+	for _, op := range plan.Ops {
+		ops = append(ops, string(op.Action)+" "+op.Path)
+	}
+
+	return ops
+}
+
+func TestPlanSyncChecksumRecordsFailures(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("srv/same.txt", []byte("aaaa"), 0o644)
+	m.WriteFile("srv/changed.txt", []byte("bbbb"), 0o644)
+	m.WriteFile("srv/broken.txt", []byte("cccc"), 0o644)
+
+	// The contents endpoint is unusable, as it is for large files, and one
+	// of the downloads fails.
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/files/contents") ||
+				(r.URL.Path == "/download/file" && strings.HasSuffix(r.URL.Query().Get("file"), "broken.txt")) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":[{"code":"BadRequestHttpException","status":"400","detail":"too large"}]}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	local := writeLocalTree(t, map[string]string{
+		"same.txt":    "aaaa",
+		"changed.txt": "BBBB",
+		"broken.txt":  "cccc",
+	})
+
+	plan, err := c.PlanSync(context.Background(), "abc", local, "/srv", SyncOptions{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"skip broken.txt", "upload changed.txt"}
+	if got := planOps(plan); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if plan.Err() == nil {
+		t.Fatal("expected the failed comparison to be reported")
+	}
+}
+
+func TestSyncIncludeOnlyCreatesNeededDirectories(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("srv/logs/latest.log", []byte("log"), 0o644)
+	m.WriteFile("srv/plugins/old.jar", []byte("old"), 0o644)
+	c := newTestPanel(t, m)
+
+	local := writeLocalTree(t, map[string]string{
+		"plugins/new.jar":        "new",
+		"plugins/config.yml":     "config",
+		"world/level.dat":        "level",
+		"config/extra/notes.txt": "notes",
+	})
+
+	plan, err := c.Sync(context.Background(), "abc", local, "/srv", SyncOptions{
+		Include: []string{"*.jar"},
+		Delete:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = plan.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"upload plugins/new.jar", "delete plugins/old.jar"}
+	if got := planOps(plan); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	want = []string{"srv/logs/latest.log", "srv/plugins/new.jar"}
+	if got := m.Files(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected remote files %q, got %q", want, got)
+	}
+	for _, dir := range []string{"srv/world", "srv/config"} {
+		if _, err = m.Stat(dir); err == nil {
+			t.Fatalf("%s was created without any selected files", dir)
+		}
+	}
+}
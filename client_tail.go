@@ -0,0 +1,286 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type TailOptions struct {
+	PollInterval time.Duration
+	Backlog      int
+	Filter       *regexp.Regexp
+}
+
+// Tailer follows a file through the file manager API; see Client.Tail.
+type Tailer struct {
+	lines  chan string
+	err    error
+	cancel context.CancelFunc
+}
+
+// tailState tracks how much of the file has been emitted. The bytes just
+// before offset are remembered and requested again on every read, so that a
+// file replaced by one that is not smaller is noticed, which a size check
+// alone would miss. An offset of -1 means the file has not been seen yet.
+type tailState struct {
+	offset  int64
+	tail    []byte
+	partial []byte
+	modTime time.Time
+}
+
+const (
+	tailCheckSize    = 256
+	tailBacklogChunk = 64 * 1024
+)
+
+// Tail follows file like "tail -f", for servers without a console
+// connection. The file is polled every PollInterval and only complete new
+// lines are emitted, starting with the last Backlog lines of the file when
+// it is first seen, or all of them when Backlog is negative. When the file
+// shrinks or is replaced it is read from the start again, and while it is
+// missing, for example during rotation, polling simply continues. Only the
+// new part of the file is downloaded, with a ranged request.
+func (c *Client) Tail(ctx context.Context, identifier, file string, opts TailOptions) *Tailer {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	t := &Tailer{lines: make(chan string), cancel: cancel}
+
+	go func() {
+		defer close(t.lines)
+		defer cancel()
+
+		state := &tailState{offset: -1}
+		for {
+			if err := c.pollTail(ctx, identifier, remotePath(file), state, opts, t.lines); err != nil {
+				if ctx.Err() == nil {
+					t.err = err
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(opts.PollInterval):
+			}
+		}
+	}()
+
+	return t
+}
+
+func (c *Client) pollTail(ctx context.Context, identifier, file string, state *tailState, opts TailOptions, out chan<- string) error {
+	info, err := c.statServerFile(identifier, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		// A file that was seen before starts over when it reappears.
+		if state.offset > 0 {
+			state.offset, state.tail, state.partial = 0, nil, nil
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	modTime := info.ModTime()
+	if info.Size == state.offset && modTime.Equal(state.modTime) {
+		return nil
+	}
+
+	// data is read from the offset from, and its first skip bytes were
+	// already emitted.
+	var (
+		from, skip int64
+		data       []byte
+	)
+	switch {
+	case state.offset < 0:
+		from, data, err = c.tailBacklog(ctx, identifier, file, info.Size, opts.Backlog)
+		if err == nil {
+			skip = backlogOffset(data, opts.Backlog)
+		}
+	case info.Size < state.offset:
+		state.offset, state.tail, state.partial = 0, nil, nil
+		data, err = c.readServerFileFrom(ctx, identifier, file, 0)
+	default:
+		from = state.offset - int64(len(state.tail))
+		data, err = c.readServerFileFrom(ctx, identifier, file, from)
+		if err == nil && !bytes.HasPrefix(data, state.tail) {
+			// Replaced, so everything is new.
+			from, state.tail, state.partial = 0, nil, nil
+			data, err = c.readServerFileFrom(ctx, identifier, file, 0)
+		}
+		skip = int64(len(state.tail))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) < skip {
+		// Shrunk since it was checked, the next poll starts over.
+		return nil
+	}
+
+	state.modTime = modTime
+	state.offset = from + int64(len(data))
+	state.tail = append([]byte(nil), data[max64(0, int64(len(data))-tailCheckSize):]...)
+
+	buf := append(state.partial, data[skip:]...)
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		state.partial = buf
+		return nil
+	}
+	state.partial = append([]byte(nil), buf[end+1:]...)
+
+	for _, line := range strings.Split(string(buf[:end]), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if opts.Filter != nil && !opts.Filter.MatchString(line) {
+			continue
+		}
+
+		select {
+		case out <- line:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// tailBacklog reads the end of a file of the given size, far enough back to
+// hold its last n complete lines, and returns where the read started.
+func (c *Client) tailBacklog(ctx context.Context, identifier, file string, size int64, n int) (int64, []byte, error) {
+	from := int64(0)
+	if n >= 0 {
+		from = max64(0, size-tailBacklogChunk)
+	}
+
+	for {
+		data, err := c.readServerFileFrom(ctx, identifier, file, from)
+		if err != nil || from == 0 || bytes.Count(data, []byte("\n")) > n {
+			return from, data, err
+		}
+
+		from = max64(0, from-int64(len(data))-tailBacklogChunk)
+	}
+}
+
+// readServerFileFrom downloads file from offset on through a signed URL
+// with a ranged request, which unlike GetServerFileContents is not limited
+// by the panel's maximum edit size.
+func (c *Client) readServerFileFrom(ctx context.Context, identifier, file string, offset int64) ([]byte, error) {
+	u, err := c.getDownloadUrl(identifier, file)
+	if isNotFound(err) {
+		return nil, &fs.PathError{Op: "read", Path: file, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := c.Http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		if start, _, ok := parseContentRange(res.Header.Get("Content-Range")); !ok || start != offset {
+			return nil, fmt.Errorf("unexpected content range %q for offset %d", res.Header.Get("Content-Range"), offset)
+		}
+	case http.StatusOK:
+		// The range was ignored.
+		if _, err = io.CopyN(io.Discard, res.Body, offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, &fs.PathError{Op: "read", Path: file, Err: fs.ErrNotExist}
+	default:
+		return nil, &downloadStatusError{code: res.StatusCode, status: res.Status}
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// backlogOffset returns the offset of the start of the last n complete
+// lines of content, or 0 when n is negative. A trailing incomplete line is
+// always included, so it is emitted once it has been completed.
+func backlogOffset(content []byte, n int) int64 {
+	if n < 0 {
+		return 0
+	}
+
+	end := bytes.LastIndexByte(content, '\n')
+	for end >= 0 && n > 0 {
+		end = bytes.LastIndexByte(content[:end], '\n')
+		n--
+	}
+
+	return int64(end + 1)
+}
+
+// Lines returns the channel of new lines, which is closed once tailing
+// stops.
+func (t *Tailer) Lines() <-chan string {
+	return t.lines
+}
+
+// All returns the new lines as an iterator. Breaking out of the loop stops
+// tailing.
+func (t *Tailer) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for line := range t.lines {
+			if !yield(line) {
+				t.Stop()
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped tailing, if any, once Lines is closed.
+func (t *Tailer) Err() error {
+	return t.err
+}
+
+// Stop stops tailing and closes Lines.
+func (t *Tailer) Stop() {
+	t.cancel()
+}
@@ -0,0 +1,220 @@
+package crocgodyl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pollLines runs a single poll and returns the lines it emitted.
+func pollLines(t *testing.T, c *Client, state *tailState, opts TailOptions) []string {
+	t.Helper()
+
+	out := make(chan string, 4096)
+	if err := c.pollTail(context.Background(), "abc", "/latest.log", state, opts, out); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+
+	var lines []string
+	for line := range out {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func numberedLines(prefix string, n int) string {
+	sb := &strings.Builder{}
+	for i := 0; i < n; i++ {
+		sb.WriteString(prefix + strings.Repeat("x", 40) + "\n")
+	}
+
+	return sb.String()
+}
+
+func TestTailRotationThenAppend(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+	state := &tailState{offset: -1}
+
+	// Larger than tailHeadSize, so the head is filled completely.
+	old := numberedLines("old", 10)
+	m.WriteFile("latest.log", []byte(old), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{}); len(lines) != 0 {
+		t.Fatalf("expected no backlog, got %q", lines)
+	}
+
+	m.WriteFile("latest.log", []byte(old+"first\n"), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{}); !reflect.DeepEqual(lines, []string{"first"}) {
+		t.Fatalf("unexpected lines after append: %q", lines)
+	}
+
+	rotated := numberedLines("new", 8)
+	m.WriteFile("latest.log", []byte(rotated), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{}); len(lines) != 8 {
+		t.Fatalf("expected the 8 lines of the rotated file, got %d", len(lines))
+	}
+
+	// Appends to the rotated file must not be mistaken for another rotation.
+	for i, line := range []string{"second", "third"} {
+		rotated += line + "\n"
+		time.Sleep(time.Millisecond)
+		m.WriteFile("latest.log", []byte(rotated), 0o644)
+
+		lines := pollLines(t, c, state, TailOptions{})
+		if !reflect.DeepEqual(lines, []string{line}) {
+			t.Fatalf("append %d: expected only %q, got %q", i, line, lines)
+		}
+	}
+}
+
+func TestTailTruncateAndPartialLines(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+	state := &tailState{offset: -1}
+
+	m.WriteFile("latest.log", []byte("a\nb\nc\npart"), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{Backlog: 2}); !reflect.DeepEqual(lines, []string{"b", "c"}) {
+		t.Fatalf("unexpected backlog: %q", lines)
+	}
+
+	m.WriteFile("latest.log", []byte("a\nb\nc\npartial\n"), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{}); !reflect.DeepEqual(lines, []string{"partial"}) {
+		t.Fatalf("unexpected completed line: %q", lines)
+	}
+
+	m.WriteFile("latest.log", []byte("x\n"), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{}); !reflect.DeepEqual(lines, []string{"x"}) {
+		t.Fatalf("unexpected lines after truncation: %q", lines)
+	}
+}
+
+func TestTailStopsOnCancel(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("latest.log", []byte("one\ntwo\n"), 0o644)
+	c := newTestPanel(t, m)
+
+	tail := c.Tail(context.Background(), "abc", "latest.log", TailOptions{PollInterval: 10 * time.Millisecond, Backlog: -1})
+
+	var lines []string
+	tail.All()(func(line string) bool {
+		lines = append(lines, line)
+		return len(lines) < 2
+	})
+
+	select {
+	case _, ok := <-tail.Lines():
+		if ok {
+			t.Fatal("expected the lines channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("tailing did not stop")
+	}
+	if !reflect.DeepEqual(lines, []string{"one", "two"}) || tail.Err() != nil {
+		t.Fatalf("unexpected result %q, %v", lines, tail.Err())
+	}
+}
+
+func TestTailBacklogWhenFileAppears(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+	state := &tailState{offset: -1}
+
+	if lines := pollLines(t, c, state, TailOptions{Backlog: 2}); len(lines) != 0 {
+		t.Fatalf("unexpected lines for a missing file: %q", lines)
+	}
+
+	m.WriteFile("latest.log", []byte("a\nb\nc\nd\n"), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{Backlog: 2}); !reflect.DeepEqual(lines, []string{"c", "d"}) {
+		t.Fatalf("expected the backlog once the file appeared, got %q", lines)
+	}
+
+	// Once seen, a file that is recreated is read from its start.
+	m.Remove("latest.log")
+	pollLines(t, c, state, TailOptions{Backlog: 2})
+	m.WriteFile("latest.log", []byte("e\nf\ng\n"), 0o644)
+	if lines := pollLines(t, c, state, TailOptions{Backlog: 2}); !reflect.DeepEqual(lines, []string{"e", "f", "g"}) {
+		t.Fatalf("expected the whole recreated file, got %q", lines)
+	}
+}
+
+func TestTailReadsRanges(t *testing.T) {
+	m := NewMemoryFS()
+
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	c := newTestPanelWith(t, m, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/files/contents"):
+				t.Errorf("the whole file was requested")
+			case r.URL.Path == "/download/file":
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				mu.Unlock()
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	requested := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		r := ranges
+		ranges = nil
+		return r
+	}
+
+	// Larger than a backlog chunk, so only its end is read at first.
+	content := numberedLines("line", 3000)
+	size := len(content)
+	m.WriteFile("latest.log", []byte(content), 0o644)
+	state := &tailState{offset: -1}
+
+	lines := pollLines(t, c, state, TailOptions{Backlog: 3})
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines of backlog, got %d", len(lines))
+	}
+	if got := requested(); !reflect.DeepEqual(got, []string{fmt.Sprintf("bytes=%d-", size-tailBacklogChunk)}) {
+		t.Fatalf("unexpected ranges %q", got)
+	}
+
+	content += "appended\n"
+	time.Sleep(time.Millisecond)
+	m.WriteFile("latest.log", []byte(content), 0o644)
+	if lines = pollLines(t, c, state, TailOptions{}); !reflect.DeepEqual(lines, []string{"appended"}) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if got := requested(); !reflect.DeepEqual(got, []string{fmt.Sprintf("bytes=%d-", size-tailCheckSize)}) {
+		t.Fatalf("unexpected ranges %q", got)
+	}
+
+	// A backlog reaching past the first chunk reads further back.
+	state = &tailState{offset: -1}
+	if lines = pollLines(t, c, state, TailOptions{Backlog: 2000}); len(lines) != 2000 || lines[1999] != "appended" {
+		t.Fatalf("expected 2000 lines of backlog, got %d", len(lines))
+	}
+}
+
+func TestTailSameSizeReplacement(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+	state := &tailState{offset: -1}
+
+	m.WriteFile("latest.log", []byte(numberedLines("old", 4)), 0o644)
+	pollLines(t, c, state, TailOptions{})
+
+	time.Sleep(time.Millisecond)
+	m.WriteFile("latest.log", []byte(numberedLines("new", 4)), 0o644)
+	lines := pollLines(t, c, state, TailOptions{})
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "new") {
+		t.Fatalf("expected the replaced file to be read again, got %q", lines)
+	}
+}
@@ -0,0 +1,289 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// UploadDirectoryOptions configures UploadDirectory. Files larger than
+// MaxFileSize, for example Node.UploadLimit, are reported with
+// ErrUploadTooLarge instead of being sent. Progress is called from the
+// upload workers, but never concurrently, with the bytes sent so far; the
+// count goes back down when a batch is sent again with a fresh URL.
+type UploadDirectoryOptions struct {
+	MaxBatchSize  int64
+	MaxBatchFiles int
+	MaxFileSize   int64
+	Concurrency   int
+	Progress      func(sent, total int64)
+}
+
+type UploadResult struct {
+	Path   string `json:"path"`
+	Remote string `json:"remote"`
+	Size   int64  `json:"size"`
+	Err    error  `json:"-"`
+}
+
+type uploadFile struct {
+	local  string
+	rel    string
+	remote string
+	size   int64
+	result *UploadResult
+}
+
+type uploadBatch struct {
+	directory string
+	files     []*uploadFile
+}
+
+// UploadDirectory uploads the local directory tree into remote, creating the
+// matching folders first. Files are grouped per target directory into
+// multipart requests of at most MaxBatchSize bytes and MaxBatchFiles files,
+// which are sent concurrently. Each batch gets its own signed upload URL, as
+// Wings rejects reused ones.
+func (c *Client) UploadDirectory(ctx context.Context, identifier, local, remote string, opts UploadDirectoryOptions) ([]*UploadResult, error) {
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = 50 * 1024 * 1024
+	}
+	if opts.MaxBatchFiles <= 0 {
+		opts.MaxBatchFiles = 50
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	remote = path.Clean("/" + remote)
+
+	var (
+		dirs    []string
+		files   []*uploadFile
+		results []*UploadResult
+		total   int64
+	)
+
+	err := filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel != "." {
+				dirs = append(dirs, rel)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		f := &uploadFile{
+			local:  p,
+			rel:    rel,
+			remote: path.Join(remote, rel),
+			size:   info.Size(),
+		}
+		f.result = &UploadResult{Path: rel, Remote: f.remote, Size: f.size}
+		results = append(results, f.result)
+
+		if opts.MaxFileSize > 0 && f.size > opts.MaxFileSize {
+			f.result.Err = ErrUploadTooLarge
+			return nil
+		}
+
+		files = append(files, f)
+		total += f.size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make([]string, 0, len(dirs)+1)
+	if remote != "/" {
+		folders = append(folders, remote)
+	}
+	for _, dir := range dirs {
+		folders = append(folders, path.Join(remote, dir))
+	}
+
+	for _, folder := range folders {
+		parent, name := path.Split(folder)
+		if err = c.CreateServerFileFolder(identifier, CreateFolderDescriptor{Root: parent, Name: name}); err != nil {
+			return results, fmt.Errorf("create folder %s: %w", folder, err)
+		}
+	}
+
+	batches := batchUploads(files, opts.MaxBatchSize, opts.MaxBatchFiles)
+
+	var (
+		sent       int64
+		progressMu sync.Mutex
+		wg         sync.WaitGroup
+		queue      = make(chan *uploadBatch)
+	)
+
+	// The workers report progress at the same time, so the calls are
+	// serialized to keep the counts in order.
+	progress := func(n int64) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+
+		sent += n
+		if opts.Progress != nil {
+			opts.Progress(sent, total)
+		}
+	}
+
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				err := c.sendUploadBatch(ctx, identifier, batch, progress)
+				for _, f := range batch.files {
+					f.result.Err = err
+				}
+			}
+		}()
+	}
+
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			for _, f := range batch.files {
+				f.result.Err = ctx.Err()
+			}
+			continue
+		}
+		queue <- batch
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, ctx.Err()
+}
+
+func batchUploads(files []*uploadFile, maxSize int64, maxFiles int) []*uploadBatch {
+	byDir := map[string][]*uploadFile{}
+	for _, f := range files {
+		dir := path.Dir(f.remote)
+		byDir[dir] = append(byDir[dir], f)
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var batches []*uploadBatch
+	for _, dir := range dirs {
+		var (
+			current *uploadBatch
+			size    int64
+		)
+
+		for _, f := range byDir[dir] {
+			if current == nil || len(current.files) >= maxFiles || (size > 0 && size+f.size > maxSize) {
+				current = &uploadBatch{directory: dir}
+				batches = append(batches, current)
+				size = 0
+			}
+
+			current.files = append(current.files, f)
+			size += f.size
+		}
+	}
+
+	return batches
+}
+
+// sendUploadBatch posts the files of batch to a freshly signed upload URL.
+// The token in the URL can only be used once, and Wings answers 404 to a
+// reused one, so a rejected request is retried once with a new URL.
+func (c *Client) sendUploadBatch(ctx context.Context, identifier string, batch *uploadBatch, progress func(int64)) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		uploadUrl, err := c.GetUploadUrl(identifier)
+		if err != nil {
+			return err
+		}
+
+		target, err := uploadTarget(uploadUrl, batch.directory)
+		if err != nil {
+			return err
+		}
+
+		var written int64
+		res, err := postMultipart(ctx, c.Http, target, func(writer *multipart.Writer) error {
+			for _, f := range batch.files {
+				if err := writeUploadPart(writer, f, func(n int64) {
+					atomic.AddInt64(&written, n)
+					progress(n)
+				}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			progress(-atomic.LoadInt64(&written))
+			continue
+		default:
+			return fmt.Errorf("recieved an unexpected response: %s", res.Status)
+		}
+	}
+
+	return errors.New("upload url was rejected after refreshing")
+}
+
+func writeUploadPart(writer *multipart.Writer, f *uploadFile, progress func(int64)) error {
+	file, err := os.Open(f.local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	part, err := writer.CreateFormFile("files", path.Base(f.remote))
+	if err != nil {
+		return err
+	}
+
+	var last int64
+	_, err = io.Copy(part, &progressReader{r: file, total: f.size, progress: func(sent, _ int64) {
+		progress(sent - last)
+		last = sent
+	}})
+	return err
+}
@@ -0,0 +1,139 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadDirectoryUsesFreshURLs(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+
+	local := t.TempDir()
+	os.MkdirAll(filepath.Join(local, "plugins", "empty"), 0o755)
+	files := map[string]string{
+		"server.properties":      "motd=hi\n",
+		"plugins/a.jar":          strings.Repeat("a", 100),
+		"plugins/b.jar":          strings.Repeat("b", 100),
+		"plugins/c.jar":          strings.Repeat("c", 100),
+		"world/level.dat":        "level",
+		"world/region/r.0.0.mca": "region",
+	}
+	for name, data := range files {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One file per batch, so every batch needs its own upload URL.
+	results, err := c.UploadDirectory(context.Background(), "abc", local, "/srv", UploadDirectoryOptions{
+		MaxBatchFiles: 1,
+		Concurrency:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("expected %d results, got %d", len(files), len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.Path, r.Err)
+		}
+
+		b, err := m.ReadFile(strings.TrimPrefix(r.Remote, "/"))
+		if err != nil || string(b) != files[r.Path] {
+			t.Fatalf("%s: unexpected remote contents %q, %v", r.Path, b, err)
+		}
+	}
+
+	if info, err := m.Stat("srv/plugins/empty"); err != nil || !info.IsDir() {
+		t.Fatalf("expected the empty directory to be created, got %v", err)
+	}
+}
+
+func TestUploaderNodeLimit(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+
+	up, err := c.UploadServerFile("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up.LimitTo(&Node{UploadSize: 1})
+
+	data := strings.Repeat("x", 2*1024*1024)
+	if err = up.ExecuteReader(context.Background(), strings.NewReader(data), "world.zip", int64(len(data))); !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("expected ErrUploadTooLarge before sending, got %v", err)
+	}
+	if err = up.ExecuteReader(context.Background(), strings.NewReader(data), "world.zip", -1); !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("expected ErrUploadTooLarge while streaming, got %v", err)
+	}
+	if _, err = m.Stat("world.zip"); err == nil {
+		t.Fatal("the oversized file was uploaded")
+	}
+
+	// The upload URL was used by the aborted request, so a new one is needed.
+	if up, err = c.UploadServerFile("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err = up.LimitTo(&Node{UploadSize: 1}).ExecuteReader(context.Background(), strings.NewReader("small"), "small.txt", 5); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := m.ReadFile("small.txt"); string(b) != "small" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+}
+
+func TestUploadDirectoryProgress(t *testing.T) {
+	m := NewMemoryFS()
+	c := newTestPanel(t, m)
+
+	local := t.TempDir()
+	var total int64
+	for i := 0; i < 8; i++ {
+		data := strings.Repeat("x", 64*1024+i)
+		total += int64(len(data))
+		if err := os.WriteFile(filepath.Join(local, fmt.Sprintf("%d.dat", i)), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		inside int32
+		calls  int
+		last   int64
+	)
+	_, err := c.UploadDirectory(context.Background(), "abc", local, "/", UploadDirectoryOptions{
+		MaxBatchFiles: 1,
+		Concurrency:   4,
+		Progress: func(sent, size int64) {
+			if atomic.AddInt32(&inside, 1) != 1 {
+				t.Error("Progress was called concurrently")
+			}
+			defer atomic.AddInt32(&inside, -1)
+
+			time.Sleep(time.Millisecond)
+			if sent < last || size != total {
+				t.Errorf("unexpected progress %d/%d after %d", sent, size, last)
+			}
+			calls++
+			last = sent
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || last != total {
+		t.Fatalf("expected progress up to %d, got %d after %d calls", total, last, calls)
+	}
+}
@@ -0,0 +1,366 @@
+package crocgodyl
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RotateOptions struct {
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+	// OnRotateError is called when rotating before a write fails. The data
+	// is written to the current file anyway and the rotation is tried again
+	// on the next write.
+	OnRotateError func(error)
+}
+
+// RotatingFile is an io.WriteCloser that moves the file it writes to aside
+// once it grows beyond MaxSize bytes or has been open longer than MaxAge.
+// Rotated files get a timestamp suffix and are optionally gzipped.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	wg       sync.WaitGroup
+	// cleanup serializes compressing and pruning rotated files.
+	cleanup sync.Mutex
+}
+
+func NewRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("a valid file path is required")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	rf := &RotatingFile{path: path, opts: opts}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (r *RotatingFile) Path() string {
+	return r.path
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	// A failed rotation leaves the current file open, so the data is still
+	// written and the rotation is tried again on the next write.
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil && r.opts.OnRotateError != nil {
+			r.opts.OnRotateError(fmt.Errorf("rotate %s: %w", r.path, err))
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) shouldRotate(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSize > 0 && r.size+next > r.opts.MaxSize {
+		return true
+	}
+	if r.opts.MaxAge > 0 && time.Since(r.openedAt) >= r.opts.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	stamp := time.Now().UTC().Format("20060102T150405.000")
+	rotated := fmt.Sprintf("%s-%s%s", base, stamp, ext)
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%s.%d%s", base, stamp, i, ext)
+	}
+
+	// The current file is only closed once its replacement is open, so that
+	// a failed rotation does not leave the writer without a file.
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+
+	old, size, openedAt := r.file, r.size, r.openedAt
+	if err := r.open(); err != nil {
+		os.Rename(rotated, r.path)
+		r.file, r.size, r.openedAt = old, size, openedAt
+		return err
+	}
+	old.Close()
+
+	if r.opts.Compress {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+
+			r.cleanup.Lock()
+			defer r.cleanup.Unlock()
+			if compressFile(rotated) == nil {
+				r.prune()
+			}
+		}()
+	} else {
+		r.cleanup.Lock()
+		r.prune()
+		r.cleanup.Unlock()
+	}
+
+	return nil
+}
+
+func (r *RotatingFile) prune() {
+	if r.opts.MaxBackups <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(r.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext + "*")
+	if err != nil || len(matches) <= r.opts.MaxBackups {
+		return
+	}
+
+	sort.Strings(matches)
+	for _, m := range matches[:len(matches)-r.opts.MaxBackups] {
+		os.Remove(m)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	r.wg.Wait()
+	return err
+}
+
+type LogStream string
+
+const (
+	StreamConsole LogStream = "console"
+	StreamInstall LogStream = "install"
+)
+
+func StreamForEvent(event string) (LogStream, bool) {
+	switch event {
+	case EventConsoleOutput, EventDaemonMessage, EventDaemonError:
+		return StreamConsole, true
+	case EventInstallOutput, EventInstallStarted, EventInstallCompleted:
+		return StreamInstall, true
+	default:
+		return "", false
+	}
+}
+
+// ConsoleLogSink writes console events to one writer per stream, prefixing
+// every line with the time it was received. Events for streams without a
+// writer are discarded.
+type ConsoleLogSink struct {
+	Writers    map[LogStream]io.Writer
+	StripANSI  bool
+	TimeFormat string
+	Now        func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewConsoleLogSink creates a sink writing console.log and install.log into
+// dir, both rotated according to opts.
+func NewConsoleLogSink(dir string, opts RotateOptions) (*ConsoleLogSink, error) {
+	sink := &ConsoleLogSink{
+		Writers:   map[LogStream]io.Writer{},
+		StripANSI: true,
+	}
+
+	for _, stream := range []LogStream{StreamConsole, StreamInstall} {
+		rf, err := NewRotatingFile(filepath.Join(dir, string(stream)+".log"), opts)
+		if err != nil {
+			sink.Close()
+			return nil, err
+		}
+		sink.Writers[stream] = rf
+	}
+
+	return sink, nil
+}
+
+func (s *ConsoleLogSink) Run(ctx context.Context, con *Console) error {
+	events, cancel := con.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case ev, ok := <-events:
+			if !ok {
+				return con.Err()
+			}
+			if err := s.WriteEvent(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *ConsoleLogSink) WriteEvent(ev *ConsoleEvent) error {
+	stream, ok := StreamForEvent(ev.Event)
+	if !ok {
+		return nil
+	}
+
+	lines := ev.Args
+	switch ev.Event {
+	case EventInstallStarted:
+		lines = []string{"installation started"}
+	case EventInstallCompleted:
+		lines = []string{"installation completed"}
+	}
+
+	for _, line := range lines {
+		if err := s.WriteLine(stream, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ConsoleLogSink) WriteLine(stream LogStream, line string) error {
+	w := s.Writers[stream]
+	if w == nil {
+		return nil
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	format := s.TimeFormat
+	if format == "" {
+		format = time.RFC3339
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	if s.StripANSI {
+		line = StripANSI(line)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(w, "[%s] %s\n", now().Format(format), line)
+	return err
+}
+
+func (s *ConsoleLogSink) Close() error {
+	var errs []error
+	for _, w := range s.Writers {
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
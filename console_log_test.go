@@ -0,0 +1,117 @@
+package crocgodyl
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileCompressAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewRotatingFile(filepath.Join(dir, "console.log"), RotateOptions{
+		MaxSize:    16,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		if _, err = rf.Write([]byte("0123456789abcdef")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "console-*"))
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 backups, got %q", matches)
+	}
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".log.gz") {
+			t.Fatalf("expected only compressed backups, got %q", matches)
+		}
+	}
+}
+
+func TestRotatingFileSurvivesFailedRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "console.log")
+	var rotateErrs []error
+	rf, err := NewRotatingFile(path, RotateOptions{
+		MaxSize:       16,
+		OnRotateError: func(err error) { rotateErrs = append(rotateErrs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	if _, err = rf.Write([]byte("first line\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renaming fails once the file is gone from under the writer.
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	n, err := rf.Write([]byte("second line\n"))
+	if err != nil {
+		t.Fatalf("expected the data to be written, got %v", err)
+	}
+	if n != len("second line\n") {
+		t.Fatalf("expected the data to be written anyway, wrote %d bytes", n)
+	}
+	if len(rotateErrs) != 1 || errors.Is(rotateErrs[0], os.ErrClosed) {
+		t.Fatalf("expected the rotation error to be reported, got %v", rotateErrs)
+	}
+
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(path, nil, 0o644)
+	if _, err = rf.Write([]byte("third line\n")); err != nil {
+		t.Fatalf("expected the writer to recover, got %v", err)
+	}
+	if _, err = rf.Write([]byte("fourth\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if string(b) != "fourth\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+}
+
+func TestConsoleLogSink(t *testing.T) {
+	console, install := &strings.Builder{}, &strings.Builder{}
+	sink := &ConsoleLogSink{
+		Writers:   map[LogStream]io.Writer{StreamConsole: console, StreamInstall: install},
+		StripANSI: true,
+		Now:       func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+
+	events := []*ConsoleEvent{
+		{Event: EventConsoleOutput, Args: []string{"\x1b[32mDone\x1b[0m (1.0s)!\r\n", "second"}},
+		{Event: EventStats, Args: []string{"{}"}},
+		{Event: EventInstallStarted},
+		{Event: EventInstallOutput, Args: []string{"installing"}},
+	}
+	for _, ev := range events {
+		if err := sink.WriteEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := "[2024-01-02T03:04:05Z] Done (1.0s)!\n[2024-01-02T03:04:05Z] second\n"; console.String() != want {
+		t.Fatalf("unexpected console log %q", console.String())
+	}
+	if want := "[2024-01-02T03:04:05Z] installation started\n[2024-01-02T03:04:05Z] installing\n"; install.String() != want {
+		t.Fatalf("unexpected install log %q", install.String())
+	}
+}
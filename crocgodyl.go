@@ -7,7 +7,9 @@ import (
 	"io"
 	"iter"
 	"net/http"
+	"net/url"
 	"slices"
+	"sync"
 )
 
 const Version = "1.0.0"
@@ -22,6 +24,10 @@ type Client struct {
 	PanelURL string
 	ApiKey   string
 	Http     *http.Client
+
+	// stops holds when a stop, kill or restart signal was last sent to each
+	// server, so that a Supervisor does not mistake it for a crash.
+	stops sync.Map
 }
 
 func NewApp(url, key string) (*Application, error) {
@@ -52,6 +58,16 @@ func (a *Application) newRequest(method, path string, body io.Reader) *http.Requ
 	return req
 }
 
+// withQuery appends the query to path, leaving path alone when the query is
+// empty.
+func withQuery(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+
+	return path + "?" + query.Encode()
+}
+
 func NewClient(url, key string) (*Client, error) {
 	if url == "" {
 		return nil, errors.New("a valid panel url is required")
@@ -0,0 +1,564 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type DiffStatus string
+
+const (
+	DiffAdded    DiffStatus = "added"
+	DiffRemoved  DiffStatus = "removed"
+	DiffModified DiffStatus = "modified"
+	// DiffUnchecked is reported for files of equal size whose contents were
+	// not compared, because they are binary, too large or failed to load.
+	DiffUnchecked DiffStatus = "unchecked"
+)
+
+type FileDiff struct {
+	Path     string     `json:"path"`
+	Status   DiffStatus `json:"status"`
+	OldSize  int64      `json:"old_size"`
+	NewSize  int64      `json:"new_size"`
+	Binary   bool       `json:"binary,omitempty"`
+	TooLarge bool       `json:"too_large,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Diff     string     `json:"diff,omitempty"`
+}
+
+type DiffReport struct {
+	Base   string      `json:"base"`
+	Target string      `json:"target"`
+	Files  []*FileDiff `json:"files"`
+}
+
+func (r *DiffReport) Empty() bool {
+	return len(r.Files) == 0
+}
+
+func (r *DiffReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+func (r *DiffReport) String() string {
+	sb := &strings.Builder{}
+	if r.Empty() {
+		sb.WriteString(fmt.Sprintf("%s and %s are identical\n", r.Base, r.Target))
+		return sb.String()
+	}
+
+	counts := map[DiffStatus]int{}
+	for _, f := range r.Files {
+		counts[f.Status]++
+	}
+	sb.WriteString(fmt.Sprintf("%s -> %s: %d added, %d removed, %d modified",
+		r.Base, r.Target, counts[DiffAdded], counts[DiffRemoved], counts[DiffModified]))
+	if counts[DiffUnchecked] > 0 {
+		sb.WriteString(fmt.Sprintf(", %d unchecked", counts[DiffUnchecked]))
+	}
+	sb.WriteString("\n\n")
+
+	for _, f := range r.Files {
+		switch f.Status {
+		case DiffAdded:
+			sb.WriteString(fmt.Sprintf("+ %s (%d bytes)\n", f.Path, f.NewSize))
+		case DiffRemoved:
+			sb.WriteString(fmt.Sprintf("- %s (%d bytes)\n", f.Path, f.OldSize))
+		case DiffModified:
+			sb.WriteString(fmt.Sprintf("~ %s (%d -> %d bytes)\n", f.Path, f.OldSize, f.NewSize))
+		case DiffUnchecked:
+			sb.WriteString(fmt.Sprintf("? %s (%d bytes)\n", f.Path, f.NewSize))
+		}
+
+		switch {
+		case f.Diff != "":
+			sb.WriteString(f.Diff)
+		case f.Error != "":
+			sb.WriteString("  cannot compare: " + f.Error + "\n")
+		case f.Binary && f.Status == DiffModified:
+			sb.WriteString("  binary files differ\n")
+		case f.TooLarge && f.Status == DiffModified:
+			sb.WriteString("  files too large to diff\n")
+		case f.Status == DiffUnchecked:
+			sb.WriteString("  binary or too large to compare\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// DiffOptions controls DiffFS. Context is the number of unchanged lines
+// shown around each change, where a negative value uses the default of 3.
+type DiffOptions struct {
+	Exclude     []string
+	SizeOnly    bool
+	MaxTextSize int64
+	Context     int
+}
+
+type diffEntry struct {
+	size   int64
+	binary bool
+}
+
+// binaryMimeType reports whether a mimetype reported by Wings is known to be
+// binary, so that such files are not downloaded just to compare them.
+func binaryMimeType(mime string) bool {
+	if mime == "" || strings.HasPrefix(mime, "text/") || strings.HasPrefix(mime, "inode/") {
+		return false
+	}
+	for _, text := range []string{"json", "xml", "yaml", "javascript", "x-sh", "toml"} {
+		if strings.Contains(mime, text) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func collectFiles(ctx context.Context, fsys fs.FS, exclude []string) (map[string]diffEntry, error) {
+	files := map[string]diffEntry{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p == "." {
+			return nil
+		}
+
+		if matchAny(exclude, p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entry := diffEntry{size: info.Size()}
+		if f, ok := info.Sys().(*File); ok {
+			entry.binary = binaryMimeType(f.MimeType)
+		}
+		files[p] = entry
+		return nil
+	})
+
+	return files, err
+}
+
+// DiffFS compares the regular files of target against base. Files of equal
+// size are compared by content unless SizeOnly is set, and modified text
+// files get a unified diff. Files above MaxTextSize bytes, and files known to
+// be binary from their mimetype, are never read: they are reported as
+// modified when their sizes differ and as unchecked otherwise. Files that
+// fail to load are reported as unchecked with the error.
+func DiffFS(ctx context.Context, base, target fs.FS, opts DiffOptions) (*DiffReport, error) {
+	if opts.MaxTextSize <= 0 {
+		opts.MaxTextSize = 64 * 1024
+	}
+	if opts.Context < 0 {
+		opts.Context = 3
+	}
+
+	old, err := collectFiles(ctx, base, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := collectFiles(ctx, target, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{Base: "base", Target: "target"}
+	for name, o := range old {
+		if _, ok := cur[name]; !ok {
+			report.Files = append(report.Files, &FileDiff{Path: name, Status: DiffRemoved, OldSize: o.size})
+		}
+	}
+
+	for name, n := range cur {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		o, ok := old[name]
+		if !ok {
+			report.Files = append(report.Files, &FileDiff{Path: name, Status: DiffAdded, NewSize: n.size})
+			continue
+		}
+
+		if o.size == n.size && opts.SizeOnly {
+			continue
+		}
+
+		diff := &FileDiff{
+			Path:     name,
+			Status:   DiffModified,
+			OldSize:  o.size,
+			NewSize:  n.size,
+			Binary:   o.binary || n.binary,
+			TooLarge: o.size > opts.MaxTextSize || n.size > opts.MaxTextSize,
+		}
+		if diff.Binary || diff.TooLarge {
+			if o.size == n.size {
+				diff.Status = DiffUnchecked
+			}
+			report.Files = append(report.Files, diff)
+			continue
+		}
+
+		a, err := fs.ReadFile(base, name)
+		if err == nil {
+			var b []byte
+			if b, err = fs.ReadFile(target, name); err == nil {
+				if bytes.Equal(a, b) {
+					continue
+				}
+
+				if isText(a) && isText(b) {
+					diff.Diff = UnifiedDiff("a/"+name, "b/"+name, string(a), string(b), opts.Context)
+				} else {
+					diff.Binary = true
+				}
+			}
+		}
+		if err != nil {
+			diff.Status, diff.Error = DiffUnchecked, err.Error()
+		}
+		report.Files = append(report.Files, diff)
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Path < report.Files[j].Path
+	})
+
+	return report, nil
+}
+
+func isText(b []byte) bool {
+	sample := b
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+
+	return bytes.IndexByte(sample, 0) < 0 && utf8.Valid(b)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// lineDiff returns the edit script turning a into b, computed from the
+// longest common subsequence of lines.
+func lineDiff(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+// lcsDiff computes the edit script with Hirschberg's algorithm, which finds
+// a longest common subsequence in space linear in the number of lines.
+func lcsDiff(a, b []string) []diffOp {
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+
+	d := &lcsDiffer{a: a, b: b, ai: intern(a), bi: intern(b), ops: make([]diffOp, 0, len(a)+len(b))}
+	d.diff(0, len(a), 0, len(b))
+	return d.ops
+}
+
+type lcsDiffer struct {
+	a, b   []string
+	ai, bi []int
+	ops    []diffOp
+}
+
+func (d *lcsDiffer) diff(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.ai[a0] == d.bi[b0] {
+		d.ops = append(d.ops, diffOp{' ', d.a[a0]})
+		a0++
+		b0++
+	}
+	tail := 0
+	for a1 > a0 && b1 > b0 && d.ai[a1-1] == d.bi[b1-1] {
+		a1--
+		b1--
+		tail++
+	}
+
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.ops = append(d.ops, diffOp{'+', d.b[j]})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.ops = append(d.ops, diffOp{'-', d.a[i]})
+		}
+	case a1-a0 == 1:
+		match := -1
+		for j := b0; j < b1 && match < 0; j++ {
+			if d.bi[j] == d.ai[a0] {
+				match = j
+			}
+		}
+		if match < 0 {
+			d.ops = append(d.ops, diffOp{'-', d.a[a0]})
+			match = b0 - 1
+		}
+		for j := b0; j < b1; j++ {
+			if j == match {
+				d.ops = append(d.ops, diffOp{' ', d.a[a0]})
+			} else {
+				d.ops = append(d.ops, diffOp{'+', d.b[j]})
+			}
+		}
+	default:
+		mid := (a0 + a1) / 2
+		fwd := d.lengths(a0, mid, b0, b1, false)
+		bwd := d.lengths(mid, a1, b0, b1, true)
+
+		// Ties go to the earliest split, so deletions come before additions.
+		split, best := 0, -1
+		for k := 0; k <= b1-b0; k++ {
+			if l := fwd[k] + bwd[b1-b0-k]; l > best {
+				split, best = k, l
+			}
+		}
+
+		d.diff(a0, mid, b0, b0+split)
+		d.diff(mid, a1, b0+split, b1)
+	}
+
+	for i := a1; i < a1+tail; i++ {
+		d.ops = append(d.ops, diffOp{' ', d.a[i]})
+	}
+}
+
+// lengths returns, for every k, the length of the longest common
+// subsequence of a[a0:a1] and the first k lines of b[b0:b1], or the last k
+// lines when reverse is set.
+func (d *lcsDiffer) lengths(a0, a1, b0, b1 int, reverse bool) []int {
+	m := b1 - b0
+	prev, row := make([]int, m+1), make([]int, m+1)
+
+	for i := 0; i < a1-a0; i++ {
+		ai := d.ai[a0+i]
+		if reverse {
+			ai = d.ai[a1-1-i]
+		}
+
+		for k := 1; k <= m; k++ {
+			bj := d.bi[b0+k-1]
+			if reverse {
+				bj = d.bi[b1-k]
+			}
+
+			switch {
+			case ai == bj:
+				row[k] = prev[k-1] + 1
+			case prev[k] >= row[k-1]:
+				row[k] = prev[k]
+			default:
+				row[k] = row[k-1]
+			}
+		}
+		prev, row = row, prev
+	}
+
+	return prev
+}
+
+// UnifiedDiff renders the differences between a and b in unified diff
+// format with the given number of context lines.
+func UnifiedDiff(nameA, nameB, a, b string, context int) string {
+	ops := lineDiff(splitLines(a), splitLines(b))
+
+	sb := &strings.Builder{}
+	sb.WriteString("--- " + nameA + "\n")
+	sb.WriteString("+++ " + nameB + "\n")
+
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+
+		end, unchanged := start, 0
+		for end < len(ops) {
+			if ops[end].kind == ' ' {
+				if unchanged == 2*context {
+					break
+				}
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end -= unchanged
+		if tail := end + context; tail < len(ops) {
+			end = tail
+		} else {
+			end = len(ops)
+		}
+
+		lineA, lineB := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				lineA++
+			}
+			if op.kind != '-' {
+				lineB++
+			}
+		}
+
+		countA, countB := 0, 0
+		for _, op := range ops[from:end] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		if countA == 0 {
+			lineA--
+		}
+		if countB == 0 {
+			lineB--
+		}
+
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB))
+		for _, op := range ops[from:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = end
+	}
+
+	return sb.String()
+}
+
+func serverSubFS(fsys *ServerFS, remote string) (fs.FS, error) {
+	root := strings.TrimPrefix(remotePath(remote), "/")
+	if root == "" {
+		return fsys, nil
+	}
+
+	return fs.Sub(fsys, root)
+}
+
+// DiffLocal reports how the remote directory differs from a local one, for
+// example a checkout of the expected configuration. Files only present on
+// the server are reported as added.
+func (c *Client) DiffLocal(ctx context.Context, identifier, remote, local string, opts DiffOptions) (*DiffReport, error) {
+	target, err := serverSubFS(c.ServerFS(identifier), remote)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := DiffFS(ctx, os.DirFS(local), target, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Base = local
+	report.Target = identifier + ":" + remotePath(remote)
+	return report, nil
+}
+
+// DiffServers reports how a directory on another server, possibly reached
+// through a different client, differs from one on this server.
+func (c *Client) DiffServers(ctx context.Context, identifier, remote string, other *Client, otherIdentifier, otherRemote string, opts DiffOptions) (*DiffReport, error) {
+	if other == nil {
+		other = c
+	}
+
+	base, err := serverSubFS(c.ServerFS(identifier), remote)
+	if err != nil {
+		return nil, err
+	}
+	target, err := serverSubFS(other.ServerFS(otherIdentifier), otherRemote)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := DiffFS(ctx, base, target, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Base = identifier + ":" + remotePath(remote)
+	report.Target = otherIdentifier + ":" + remotePath(otherRemote)
+	return report, nil
+}
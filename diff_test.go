@@ -0,0 +1,176 @@
+package crocgodyl
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// lcsLength is the textbook quadratic solution, to check lcsDiff against.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		row := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				row[j+1] = prev[j] + 1
+			case prev[j+1] >= row[j]:
+				row[j+1] = prev[j+1]
+			default:
+				row[j+1] = row[j]
+			}
+		}
+		prev = row
+	}
+
+	return prev[len(b)]
+}
+
+func TestLCSDiffIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.Intn(4))) + "\n"
+		}
+		return lines
+	}
+
+	for n := 0; n < 500; n++ {
+		a, b := randomLines(), randomLines()
+		ops := lcsDiff(a, b)
+
+		var gotA, gotB []string
+		common := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind == ' ' {
+				common++
+			}
+		}
+
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edit script does not turn %q into %q", a, b)
+		}
+		if want := lcsLength(a, b); common != want {
+			t.Fatalf("%q -> %q: kept %d lines, the longest common subsequence has %d", a, b, common, want)
+		}
+	}
+}
+
+func TestUnifiedDiffGroupsChanges(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\n"
+	b := "one\n2\n3\nfour\n"
+
+	want := "--- a\n+++ b\n@@ -1,4 +1,4 @@\n one\n-two\n-three\n+2\n+3\n four\n"
+	if got := UnifiedDiff("a", "b", a, b, 3); got != want {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+// failingFS fails to read one of its files.
+type failingFS struct {
+	fstest.MapFS
+	name string
+}
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if name == f.name {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("too large to edit")}
+	}
+
+	return f.MapFS.Open(name)
+}
+
+func (f failingFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(struct{ fs.FS }{f}, name)
+}
+
+func TestDiffFSSkipsUnreadableAndLargeFiles(t *testing.T) {
+	large := strings.Repeat("line\n", 100)
+	base := fstest.MapFS{
+		"server.properties": {Data: []byte("motd=a\nport=1\n")},
+		"world.dat":         {Data: []byte{0, 1, 2, 3}},
+		"big.log":           {Data: []byte(large)},
+		"grown.log":         {Data: []byte(large)},
+		"locked.yml":        {Data: []byte("a: 1\n")},
+	}
+	target := failingFS{name: "locked.yml", MapFS: fstest.MapFS{
+		"server.properties": {Data: []byte("motd=b\nport=1\n")},
+		"world.dat":         {Data: []byte{0, 1, 2, 4}},
+		"big.log":           {Data: []byte(strings.Replace(large, "line", "LINE", 1))},
+		"grown.log":         {Data: []byte(large + "more\n")},
+		"locked.yml":        {Data: []byte("a: 2\n")},
+	}}
+
+	report, err := DiffFS(context.Background(), base, target, DiffOptions{MaxTextSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]*FileDiff{}
+	for _, f := range report.Files {
+		got[f.Path] = f
+	}
+
+	if f := got["server.properties"]; f == nil || f.Status != DiffModified || !strings.Contains(f.Diff, "+motd=b") {
+		t.Fatalf("expected a text diff, got %+v", f)
+	}
+	if f := got["world.dat"]; f == nil || f.Status != DiffModified || !f.Binary {
+		t.Fatalf("expected a binary difference, got %+v", f)
+	}
+	if f := got["big.log"]; f == nil || f.Status != DiffUnchecked || !f.TooLarge {
+		t.Fatalf("expected an unchecked large file, got %+v", f)
+	}
+	if f := got["grown.log"]; f == nil || f.Status != DiffModified || !f.TooLarge || f.Diff != "" {
+		t.Fatalf("expected a large modified file without a diff, got %+v", f)
+	}
+	if f := got["locked.yml"]; f == nil || f.Status != DiffUnchecked || f.Error == "" {
+		t.Fatalf("expected the read error to be recorded, got %+v", f)
+	}
+}
+
+func TestBinaryMimeType(t *testing.T) {
+	for mime, binary := range map[string]bool{
+		"text/plain":               false,
+		"application/json":         false,
+		"application/x-yaml":       false,
+		"inode/x-empty":            false,
+		"application/zip":          true,
+		"application/octet-stream": true,
+		"":                         false,
+	} {
+		if binaryMimeType(mime) != binary {
+			t.Errorf("%q: expected binary to be %v", mime, binary)
+		}
+	}
+}
+
+func TestDiffFSContext(t *testing.T) {
+	base := fstest.MapFS{"server.properties": {Data: []byte("a=1\nb=2\nc=3\n")}}
+	target := fstest.MapFS{"server.properties": {Data: []byte("a=1\nb=4\nc=3\n")}}
+
+	tests := map[int]string{
+		0:  "--- a/server.properties\n+++ b/server.properties\n@@ -2,1 +2,1 @@\n-b=2\n+b=4\n",
+		-1: "--- a/server.properties\n+++ b/server.properties\n@@ -1,3 +1,3 @@\n a=1\n-b=2\n+b=4\n c=3\n",
+	}
+	for lines, want := range tests {
+		report, err := DiffFS(context.Background(), base, target, DiffOptions{Context: lines})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Files) != 1 || report.Files[0].Diff != want {
+			t.Fatalf("context %d: unexpected diff\n%+v", lines, report.Files)
+		}
+	}
+}
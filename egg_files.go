@@ -0,0 +1,663 @@
+package crocgodyl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"gopkg.in/yaml.v3"
+)
+
+type EggFileParser string
+
+const (
+	ParserProperties EggFileParser = "properties"
+	ParserYAML       EggFileParser = "yaml"
+	ParserJSON       EggFileParser = "json"
+	ParserINI        EggFileParser = "ini"
+	ParserXML        EggFileParser = "xml"
+	ParserFile       EggFileParser = "file"
+)
+
+// EggFileReplacement sets the value at Match to ReplaceWith. When IfValue is
+// set the value is only replaced if it currently equals IfValue, or, for an
+// IfValue of the form "regex:<pattern>", the matches of the pattern in the
+// current value are replaced. Parsers that have no notion of a current value
+// ignore IfValue, as Wings does.
+type EggFileReplacement struct {
+	Match       string `json:"match"`
+	IfValue     string `json:"if_value,omitempty"`
+	ReplaceWith string `json:"replace_with"`
+}
+
+// resolve returns the value to store given the current one, or false when
+// the replacement does not apply.
+func (r EggFileReplacement) resolve(current string, exists bool) (string, bool) {
+	switch {
+	case strings.HasPrefix(r.IfValue, "regex:"):
+		pattern, err := regexp.Compile(strings.TrimPrefix(r.IfValue, "regex:"))
+		if err != nil || !exists || !pattern.MatchString(current) {
+			return "", false
+		}
+		return pattern.ReplaceAllString(current, r.ReplaceWith), true
+	case r.IfValue != "":
+		return r.ReplaceWith, exists && current == r.IfValue
+	}
+
+	return r.ReplaceWith, true
+}
+
+type EggConfigFile struct {
+	Parser  EggFileParser        `json:"parser"`
+	Replace []EggFileReplacement `json:"replace"`
+}
+
+// eachObjectKey calls fn for every member of a JSON object, in document
+// order. The panel encodes empty objects as arrays, so null and [] are
+// accepted as empty.
+func eachObjectKey(data []byte, fn func(key string, value json.RawMessage) error) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" || string(data) == "[]" {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("expected an object, got %s", data)
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return err
+		}
+		if err = fn(t.(string), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scalarString(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+
+	return string(bytes.TrimSpace(value))
+}
+
+// UnmarshalJSON decodes the format used by the panel, where "find" maps a
+// key either to its new value or to an object of current value to new
+// value pairs.
+func (f *EggConfigFile) UnmarshalJSON(data []byte) error {
+	var model struct {
+		Parser EggFileParser   `json:"parser"`
+		Find   json.RawMessage `json:"find"`
+	}
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+
+	f.Parser = model.Parser
+	f.Replace = nil
+
+	return eachObjectKey(model.Find, func(key string, value json.RawMessage) error {
+		if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			return eachObjectKey(value, func(current string, replacement json.RawMessage) error {
+				f.Replace = append(f.Replace, EggFileReplacement{Match: key, IfValue: current, ReplaceWith: scalarString(replacement)})
+				return nil
+			})
+		}
+
+		f.Replace = append(f.Replace, EggFileReplacement{Match: key, ReplaceWith: scalarString(value)})
+		return nil
+	})
+}
+
+func (f *EggConfigFile) MarshalJSON() ([]byte, error) {
+	find := map[string]any{}
+	for _, r := range f.Replace {
+		if r.IfValue == "" {
+			find[r.Match] = r.ReplaceWith
+			continue
+		}
+
+		values, ok := find[r.Match].(map[string]string)
+		if !ok {
+			values = map[string]string{}
+			find[r.Match] = values
+		}
+		values[r.IfValue] = r.ReplaceWith
+	}
+
+	return json.Marshal(map[string]any{"parser": f.Parser, "find": find})
+}
+
+type EggConfigFiles map[string]*EggConfigFile
+
+func (f *EggConfigFiles) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var encoded string
+		if err := json.Unmarshal(data, &encoded); err != nil {
+			return err
+		}
+		data = []byte(encoded)
+	}
+
+	files := EggConfigFiles{}
+	err := eachObjectKey(data, func(key string, value json.RawMessage) error {
+		file := &EggConfigFile{}
+		if err := json.Unmarshal(value, file); err != nil {
+			return fmt.Errorf("config file %s: %w", key, err)
+		}
+
+		files[key] = file
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*f = files
+	return nil
+}
+
+// Names returns the configured file paths in sorted order.
+func (f EggConfigFiles) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+var placeholderPattern = regexp.MustCompile(`{{\s*([\w.-]+)\s*}}`)
+
+// EggPlaceholders holds the values substituted into "{{key}}" placeholders,
+// such as "server.build.default.port" or "env.SERVER_JARFILE". Placeholders
+// Wings fills from its own configuration, like "config.docker.interface",
+// can be added by hand.
+type EggPlaceholders map[string]string
+
+func NewEggPlaceholders(server *AppServer, allocation *Allocation) EggPlaceholders {
+	p := EggPlaceholders{
+		"server.build.memory":       strconv.FormatInt(server.Limits.Memory, 10),
+		"server.build.swap":         strconv.FormatInt(server.Limits.Swap, 10),
+		"server.build.io":           strconv.FormatInt(server.Limits.IO, 10),
+		"server.build.cpu":          strconv.FormatInt(server.Limits.CPU, 10),
+		"server.build.threads":      server.Limits.Threads,
+		"server.build.disk":         strconv.FormatInt(server.Limits.Disk, 10),
+		"server.build.oom_disabled": strconv.FormatBool(server.Limits.OOMDisabled),
+		"server.build.image":        server.Container.Image,
+	}
+
+	if allocation != nil {
+		p["server.build.default.ip"] = allocation.IP
+		p["server.build.default.port"] = strconv.Itoa(int(allocation.Port))
+	}
+
+	for key, value := range server.Container.Environment {
+		if value == nil {
+			p["env."+key] = ""
+		} else {
+			p["env."+key] = fmt.Sprint(value)
+		}
+	}
+
+	return p
+}
+
+// Expand replaces known placeholders in s. The legacy "server.build.env."
+// prefix is treated like "env.", and unknown placeholders are kept.
+func (p EggPlaceholders) Expand(s string) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		key := placeholderPattern.FindStringSubmatch(match)[1]
+		key = strings.Replace(key, "server.build.env.", "env.", 1)
+
+		if value, ok := p[key]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// Patch applies the replacements to content the way Wings does when the
+// server boots, after expanding placeholders with values. Empty content is
+// treated as a new file.
+func (f *EggConfigFile) Patch(content []byte, values EggPlaceholders) ([]byte, error) {
+	replace := make([]EggFileReplacement, 0, len(f.Replace))
+	for _, r := range f.Replace {
+		r.ReplaceWith = values.Expand(r.ReplaceWith)
+		replace = append(replace, r)
+	}
+
+	switch f.Parser {
+	case ParserFile:
+		return patchText(content, replace), nil
+	case ParserProperties:
+		return patchProperties(content, replace), nil
+	case ParserINI:
+		return patchINI(content, replace), nil
+	case ParserJSON:
+		return patchJSON(content, replace)
+	case ParserYAML:
+		return patchYAML(content, replace)
+	case ParserXML:
+		return patchXML(content, replace)
+	default:
+		return nil, fmt.Errorf("unsupported config parser %q", f.Parser)
+	}
+}
+
+func scanLines(content []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines
+}
+
+func joinLines(lines []string) []byte {
+	buf := bytes.Buffer{}
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// patchText replaces every line starting with a match as a whole.
+func patchText(content []byte, replace []EggFileReplacement) []byte {
+	lines := scanLines(content)
+	for i, line := range lines {
+		for _, r := range replace {
+			if strings.HasPrefix(line, r.Match) {
+				line = r.ReplaceWith
+			}
+		}
+		lines[i] = line
+	}
+
+	return joinLines(lines)
+}
+
+// splitKeyValue splits a properties or ini line into its key, the text up
+// to the start of the value, and the value.
+func splitKeyValue(line string, separators string) (key, prefix, value string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.ContainsAny(trimmed[:1], "#!;[") {
+		return "", "", "", false
+	}
+
+	end := strings.IndexAny(line, separators)
+	if end < 0 {
+		return strings.TrimSpace(line), line, "", true
+	}
+
+	start := end + 1
+	for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+
+	return strings.TrimSpace(line[:end]), line[:start], line[start:], true
+}
+
+func patchProperties(content []byte, replace []EggFileReplacement) []byte {
+	lines := scanLines(content)
+
+	for _, r := range replace {
+		found := false
+		for i, line := range lines {
+			key, prefix, current, ok := splitKeyValue(line, "=:")
+			if !ok || key != r.Match {
+				continue
+			}
+
+			found = true
+			if value, ok := r.resolve(current, true); ok {
+				if !strings.ContainsAny(prefix, "=:") {
+					prefix = key + "="
+				}
+				lines[i] = prefix + strings.ReplaceAll(value, `\`, `\\`)
+			}
+		}
+
+		if value, ok := r.resolve("", false); !found && ok {
+			lines = append(lines, r.Match+"="+strings.ReplaceAll(value, `\`, `\\`))
+		}
+	}
+
+	return joinLines(lines)
+}
+
+// iniPath splits a match into section and key on the first dot outside of
+// brackets. A match without a dot refers to the default section.
+func iniPath(match string) (section, key string) {
+	depth := 0
+	for i, c := range match {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				return strings.Trim(match[:i], "[]"), match[i+1:]
+			}
+		}
+	}
+
+	return "", match
+}
+
+func iniSection(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
+
+func patchINI(content []byte, replace []EggFileReplacement) []byte {
+	lines := scanLines(content)
+
+	for _, r := range replace {
+		section, key := iniPath(r.Match)
+
+		start, end, found := 0, len(lines), section == ""
+		for i, line := range lines {
+			name, ok := iniSection(line)
+			if !ok {
+				continue
+			}
+			if found {
+				end = i
+				break
+			}
+			if name == section {
+				start, found = i+1, true
+			}
+		}
+
+		if !found {
+			if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+				lines = append(lines, "")
+			}
+			lines = append(lines, "["+section+"]", key+" = "+r.ReplaceWith)
+			continue
+		}
+
+		replaced := false
+		for i := start; i < end; i++ {
+			k, prefix, _, ok := splitKeyValue(lines[i], "=:")
+			if !ok || k != key {
+				continue
+			}
+			if !strings.ContainsAny(prefix, "=:") {
+				prefix = key + " = "
+			}
+			lines[i] = prefix + r.ReplaceWith
+			replaced = true
+		}
+
+		if !replaced {
+			at := end
+			for at > start && strings.TrimSpace(lines[at-1]) == "" {
+				at--
+			}
+			lines = append(lines[:at], append([]string{key + " = " + r.ReplaceWith}, lines[at:]...)...)
+		}
+	}
+
+	return joinLines(lines)
+}
+
+// typedValue converts a replacement into the value written to structured
+// files: integers and booleans keep their type, everything else is a
+// string.
+func typedValue(value string) any {
+	if v, err := strconv.Atoi(value); err == nil {
+		return v
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+
+	return value
+}
+
+var arrayElementPattern = regexp.MustCompile(`^(.+)\[(\d+)]$`)
+
+// jsonPath splits a dotted path into segments, turning "key[1]" into the
+// segments "key" and "[1]".
+func jsonPath(match string) []string {
+	var segments []string
+	for _, seg := range strings.Split(match, ".") {
+		if m := arrayElementPattern.FindStringSubmatch(seg); m != nil {
+			segments = append(segments, m[1], "["+m[2]+"]")
+			continue
+		}
+		segments = append(segments, seg)
+	}
+
+	return segments
+}
+
+// setPath sets the value at the path in a decoded document, creating
+// missing objects. A "*" segment applies the rest of the path to every
+// element of an array or object, and an "[i]" segment addresses an array
+// element; a missing array is only created for index 0.
+func setPath(node any, segments []string, r EggFileReplacement) any {
+	if len(segments) == 0 {
+		current := ""
+		if node != nil {
+			current = fmt.Sprint(node)
+		}
+
+		value, ok := r.resolve(current, node != nil)
+		switch {
+		case !ok:
+			return node
+		case strings.HasPrefix(r.IfValue, "regex:"):
+			return value
+		}
+		return typedValue(value)
+	}
+
+	seg, rest := segments[0], segments[1:]
+	conditional := r.IfValue != ""
+
+	if strings.HasPrefix(seg, "[") {
+		i, _ := strconv.Atoi(strings.Trim(seg, "[]"))
+		n, ok := node.([]any)
+		switch {
+		case ok && i < len(n):
+			n[i] = setPath(n[i], rest, r)
+			return n
+		case !ok && i == 0 && !conditional:
+			return []any{setPath(nil, rest, r)}
+		}
+		return node
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		if seg == "*" {
+			for k, v := range n {
+				n[k] = setPath(v, rest, r)
+			}
+			return n
+		}
+
+		child, ok := n[seg]
+		if !ok && conditional {
+			return n
+		}
+		n[seg] = setPath(child, rest, r)
+		return n
+	case []any:
+		if seg == "*" {
+			for i, v := range n {
+				n[i] = setPath(v, rest, r)
+			}
+		}
+		return n
+	}
+
+	if seg == "*" || conditional {
+		return node
+	}
+
+	return map[string]any{seg: setPath(nil, rest, r)}
+}
+
+func patchTree(tree any, replace []EggFileReplacement) any {
+	if tree == nil {
+		tree = map[string]any{}
+	}
+	for _, r := range replace {
+		tree = setPath(tree, jsonPath(r.Match), r)
+	}
+
+	return tree
+}
+
+func patchJSON(content []byte, replace []EggFileReplacement) ([]byte, error) {
+	var tree any
+	if len(bytes.TrimSpace(content)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		if err := dec.Decode(&tree); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(patchTree(tree, replace)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func patchYAML(content []byte, replace []EggFileReplacement) ([]byte, error) {
+	var tree any
+	if err := yaml.Unmarshal(content, &tree); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(patchTree(tree, replace))
+}
+
+var xmlAttributePattern = regexp.MustCompile(`^\[(\w+)='(.*)']$`)
+
+// patchXML sets the text of the elements at the dotted path, creating them
+// when the path has no wildcard. A value of the form [name='value'] sets an
+// attribute instead.
+func patchXML(content []byte, replace []EggFileReplacement) ([]byte, error) {
+	doc := etree.NewDocument()
+	if len(bytes.TrimSpace(content)) > 0 {
+		if err := doc.ReadFromBytes(content); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range replace {
+		parts := strings.Split(r.Match, ".")
+		if doc.Root() == nil {
+			doc.SetRoot(etree.NewElement(parts[0]))
+		}
+
+		if !strings.Contains(r.Match, "*") && doc.Root().Tag == parts[0] {
+			element := doc.Root()
+			for _, tag := range parts[1:] {
+				if e := element.FindElement(tag); e != nil {
+					element = e
+				} else {
+					element = element.CreateElement(tag)
+				}
+			}
+		}
+
+		for _, element := range doc.FindElements("./" + strings.Join(parts, "/")) {
+			if m := xmlAttributePattern.FindStringSubmatch(r.ReplaceWith); m != nil {
+				element.CreateAttr(m[1], m[2])
+			} else {
+				element.SetText(r.ReplaceWith)
+			}
+		}
+	}
+
+	doc.Indent(4)
+	return doc.WriteToBytes()
+}
+
+// PreviewEggConfigFiles returns the contents each configured file would
+// have after Wings patched it on boot, keyed by path. Files that do not
+// exist yet start out empty, as Wings creates them.
+func (c *Client) PreviewEggConfigFiles(identifier string, files EggConfigFiles, values EggPlaceholders) (map[string][]byte, error) {
+	patched := make(map[string][]byte, len(files))
+	for _, name := range files.Names() {
+		content, err := c.GetServerFileContents(identifier, remotePath(name))
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+
+		if patched[name], err = files[name].Patch(content, values); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return patched, nil
+}
+
+// ApplyEggConfigFiles patches the configured files on the server right away
+// instead of waiting for the next boot. Existing files are changed through
+// EditFile, so concurrent modifications are detected.
+func (c *Client) ApplyEggConfigFiles(identifier string, files EggConfigFiles, values EggPlaceholders) error {
+	for _, name := range files.Names() {
+		file := files[name]
+		err := c.EditFile(identifier, name, func(content []byte) ([]byte, error) {
+			return file.Patch(content, values)
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			var content []byte
+			if content, err = file.Patch(nil, values); err == nil {
+				err = c.WriteServerFileBytes(identifier, remotePath(name), "text/plain", content)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package crocgodyl
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEggConfigFilePatch(t *testing.T) {
+	values := EggPlaceholders{
+		"server.build.default.port": "25565",
+		"env.MOTD":                  "Hello",
+	}
+
+	tests := []struct {
+		name    string
+		parser  EggFileParser
+		replace []EggFileReplacement
+		in      string
+		out     string
+	}{
+		{
+			name:    "file replaces matching lines",
+			parser:  ParserFile,
+			replace: []EggFileReplacement{{Match: "port", ReplaceWith: "port {{server.build.default.port}}"}},
+			in:      "name test\nport 1\nport_extra 2\n",
+			out:     "name test\nport 25565\nport 25565\n",
+		},
+		{
+			name:   "properties keeps separators and appends missing keys",
+			parser: ParserProperties,
+			replace: []EggFileReplacement{
+				{Match: "server-port", ReplaceWith: "{{server.build.default.port}}"},
+				{Match: "motd", ReplaceWith: "{{env.MOTD}}"},
+				{Match: "level-name", ReplaceWith: `C:\world`},
+			},
+			in:  "# comment\nserver-port = 1\nmotd: old\n",
+			out: "# comment\nserver-port = 25565\nmotd: Hello\nlevel-name=C:\\\\world\n",
+		},
+		{
+			name:   "properties if value",
+			parser: ParserProperties,
+			replace: []EggFileReplacement{
+				{Match: "a", IfValue: "1", ReplaceWith: "x"},
+				{Match: "b", IfValue: "1", ReplaceWith: "x"},
+				{Match: "c", IfValue: "regex:^(\\d+)$", ReplaceWith: "n$1"},
+				{Match: "d", IfValue: "1", ReplaceWith: "x"},
+			},
+			in:  "a=1\nb=2\nc=42\n",
+			out: "a=x\nb=2\nc=n42\n",
+		},
+		{
+			name:   "ini sections",
+			parser: ParserINI,
+			replace: []EggFileReplacement{
+				{Match: "global", ReplaceWith: "1"},
+				{Match: "server.port", ReplaceWith: "{{server.build.default.port}}"},
+				{Match: "server.name", ReplaceWith: "test"},
+				{Match: "[other.section].key", ReplaceWith: "v"},
+			},
+			in:  "[server]\nport = 1\n\n[misc]\nkey = x\n",
+			out: "global = 1\n[server]\nport = 25565\nname = test\n\n[misc]\nkey = x\n\n[other.section]\nkey = v\n",
+		},
+		{
+			name:   "json typed values and paths",
+			parser: ParserJSON,
+			replace: []EggFileReplacement{
+				{Match: "port", ReplaceWith: "{{server.build.default.port}}"},
+				{Match: "online", ReplaceWith: "true"},
+				{Match: "listeners[0].host", ReplaceWith: "0.0.0.0"},
+				{Match: "servers.*.motd", ReplaceWith: "{{env.MOTD}}"},
+				{Match: "new.key", ReplaceWith: "v"},
+				{Match: "name", IfValue: "other", ReplaceWith: "skipped"},
+			},
+			in: `{"name":"test","listeners":[{"host":"127.0.0.1"}],"servers":{"a":{"motd":""},"b":{"motd":""}}}`,
+			out: `{
+    "listeners": [
+        {
+            "host": "0.0.0.0"
+        }
+    ],
+    "name": "test",
+    "new": {
+        "key": "v"
+    },
+    "online": true,
+    "port": 25565,
+    "servers": {
+        "a": {
+            "motd": "Hello"
+        },
+        "b": {
+            "motd": "Hello"
+        }
+    }
+}
+`,
+		},
+		{
+			name:    "json new file",
+			parser:  ParserJSON,
+			replace: []EggFileReplacement{{Match: "list[0]", ReplaceWith: "a"}},
+			out:     "{\n    \"list\": [\n        \"a\"\n    ]\n}\n",
+		},
+		{
+			name:   "yaml",
+			parser: ParserYAML,
+			replace: []EggFileReplacement{
+				{Match: "server.port", ReplaceWith: "{{server.build.default.port}}"},
+				{Match: "server.host", IfValue: "regex:^127\\.", ReplaceWith: "10."},
+				{Match: "debug", ReplaceWith: "false"},
+			},
+			in:  "server:\n  host: 127.0.0.1\n  port: 1\n",
+			out: "debug: false\nserver:\n    host: 10.0.0.1\n    port: 25565\n",
+		},
+		{
+			name:   "xml elements and attributes",
+			parser: ParserXML,
+			replace: []EggFileReplacement{
+				{Match: "config.port", ReplaceWith: "{{server.build.default.port}}"},
+				{Match: "config.motd", ReplaceWith: "[value='{{env.MOTD}}']"},
+				{Match: "config.items.*", ReplaceWith: "x"},
+			},
+			in:  "<config><port>1</port><items><a>1</a><b>2</b></items></config>",
+			out: "<config>\n    <port>25565</port>\n    <items>\n        <a>x</a>\n        <b>x</b>\n    </items>\n    <motd value=\"Hello\"/>\n</config>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &EggConfigFile{Parser: tt.parser, Replace: tt.replace}
+			out, err := file.Patch([]byte(tt.in), values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.out {
+				t.Fatalf("unexpected result\n got: %q\nwant: %q", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestEggConfigFilePatchErrors(t *testing.T) {
+	tests := []struct {
+		parser EggFileParser
+		in     string
+	}{
+		{ParserJSON, "{"},
+		{ParserYAML, "a: [b"},
+		{ParserXML, "<a><b></a>"},
+		{"toml", ""},
+	}
+
+	for _, tt := range tests {
+		file := &EggConfigFile{Parser: tt.parser, Replace: []EggFileReplacement{{Match: "a", ReplaceWith: "b"}}}
+		if _, err := file.Patch([]byte(tt.in), nil); err == nil {
+			t.Errorf("%s: expected an error for %q", tt.parser, tt.in)
+		}
+	}
+}
+
+func TestEggPlaceholdersExpand(t *testing.T) {
+	p := EggPlaceholders{"env.PORT": "1", "server.build.default.ip": "0.0.0.0"}
+
+	tests := map[string]string{
+		"{{env.PORT}}":                             "1",
+		"{{ server.build.env.PORT }}":              "1",
+		"{{server.build.default.ip}}:{{env.PORT}}": "0.0.0.0:1",
+		"{{config.docker.interface}}":              "{{config.docker.interface}}",
+		"plain":                                    "plain",
+	}
+	for in, want := range tests {
+		if got := p.Expand(in); got != want {
+			t.Errorf("Expand(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEggConfigFilesDecode(t *testing.T) {
+	const files = `{"b.properties":{"parser":"properties","find":{"z":"1","a":{"old":"new","x":"y"}}},"a.json":{"parser":"json","find":[]}}`
+
+	tests := map[string]string{
+		"object": files,
+		"string": string(mustMarshal(t, files)),
+	}
+	for name, data := range tests {
+		var decoded EggConfigFiles
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if got := decoded.Names(); !reflect.DeepEqual(got, []string{"a.json", "b.properties"}) {
+			t.Fatalf("%s: unexpected names %q", name, got)
+		}
+		if len(decoded["a.json"].Replace) != 0 {
+			t.Fatalf("%s: expected no replacements, got %v", name, decoded["a.json"].Replace)
+		}
+
+		want := []EggFileReplacement{
+			{Match: "z", ReplaceWith: "1"},
+			{Match: "a", IfValue: "old", ReplaceWith: "new"},
+			{Match: "a", IfValue: "x", ReplaceWith: "y"},
+		}
+		if got := decoded["b.properties"].Replace; !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: unexpected replacements %v", name, got)
+		}
+	}
+
+	var empty EggConfigFiles
+	if err := json.Unmarshal([]byte(`[]`), &empty); err != nil || len(empty) != 0 {
+		t.Fatalf("expected [] to decode as empty, got %v, %v", empty, err)
+	}
+}
+
+func TestEggConfigFiles(t *testing.T) {
+	const data = `{"config":{"files":{"server.properties":{"parser":"properties","find":{"server-port":"{{server.build.default.port}}","motd":"hi"}}}}}`
+
+	var egg Egg
+	if err := json.Unmarshal([]byte(data), &egg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := egg.Config.Files["server.properties"].(map[string]any); !ok {
+		t.Fatalf("expected the raw files map, got %v", egg.Config.Files)
+	}
+
+	want := []EggFileReplacement{
+		{Match: "server-port", ReplaceWith: "{{server.build.default.port}}"},
+		{Match: "motd", ReplaceWith: "hi"},
+	}
+
+	files, err := egg.ConfigFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := files["server.properties"].Replace; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected replacements %v", got)
+	}
+
+	// An egg built by hand only has the map, so the order of the
+	// replacements is not kept.
+	built := Egg{}
+	built.Config.Files = egg.Config.Files
+	if files, err = built.ConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if got := files["server.properties"].Replace; len(got) != 2 {
+		t.Fatalf("unexpected replacements %v", got)
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -1,3 +1,16 @@
 module github.com/ruscalworld/crocgodyl
 
 go 1.20
+
+require (
+	github.com/beevik/etree v1.2.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/pkg/sftp v1.13.6
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
@@ -0,0 +1,365 @@
+package crocgodyl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is an amount of memory or disk space in bytes. The panel works in
+// megabytes, the unit of Limits.Memory, Limits.Disk and Limits.Swap, so
+// sizes are converted with Megabytes before being sent. For memory and disk
+// 0 means unlimited.
+type ByteSize int64
+
+const (
+	Unlimited ByteSize = 0
+
+	KiB ByteSize = 1 << 10
+	MiB          = 1024 * KiB
+	GiB          = 1024 * MiB
+	TiB          = 1024 * GiB
+)
+
+// byteUnits maps size suffixes to their size in kibibytes. Decimal suffixes
+// are read as binary ones, the same way the panel labels megabytes.
+var byteUnits = map[string]float64{
+	"k": 1, "kb": 1, "kib": 1,
+	"": 1 << 10, "m": 1 << 10, "mb": 1 << 10, "mib": 1 << 10,
+	"g": 1 << 20, "gb": 1 << 20, "gib": 1 << 20,
+	"t": 1 << 30, "tb": 1 << 30, "tib": 1 << 30,
+}
+
+// maxMegabytes is the largest number of megabytes a ByteSize can hold.
+const maxMegabytes = math.MaxInt64 >> 20
+
+// ParseByteSize parses a size such as "512M", "2GiB" or "1.5 GB", or
+// "unlimited". A bare number is in megabytes, and the size must come out as
+// a whole number of megabytes.
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "unlimited" {
+		return Unlimited, nil
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	unit, ok := byteUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	kib := n * unit
+	if kib != math.Trunc(kib) || math.Mod(kib, 1024) != 0 {
+		return 0, fmt.Errorf("invalid size %q: not a whole number of megabytes", s)
+	}
+	if kib/1024 > maxMegabytes {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+
+	return ByteSize(kib/1024) * MiB, nil
+}
+
+// MustParseByteSize is like ParseByteSize but panics on an invalid size,
+// for use with constants.
+func MustParseByteSize(s string) ByteSize {
+	b, err := ParseByteSize(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// Megabytes returns the size in the unit the panel expects, rounded down.
+func (b ByteSize) Megabytes() int64 {
+	return int64(b / MiB)
+}
+
+func (b ByteSize) Bytes() int64 {
+	return int64(b)
+}
+
+// String formats the size in the largest unit that represents it exactly,
+// for example "2GiB" or "1536MiB".
+func (b ByteSize) String() string {
+	switch {
+	case b == Unlimited:
+		return "unlimited"
+	case b%TiB == 0:
+		return strconv.FormatInt(int64(b/TiB), 10) + "TiB"
+	case b%GiB == 0:
+		return strconv.FormatInt(int64(b/GiB), 10) + "GiB"
+	case b%MiB == 0:
+		return strconv.FormatInt(int64(b/MiB), 10) + "MiB"
+	case b%KiB == 0:
+		return strconv.FormatInt(int64(b/KiB), 10) + "KiB"
+	default:
+		return strconv.FormatInt(int64(b), 10) + "B"
+	}
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*b = size
+	return nil
+}
+
+// UnmarshalJSON accepts both a number of megabytes and a size string.
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return b.UnmarshalText([]byte(s))
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	if n > maxMegabytes || n < -maxMegabytes {
+		return fmt.Errorf("invalid size %d: too large", n)
+	}
+
+	*b = ByteSize(n) * MiB
+	return nil
+}
+
+// SwapSize is the swap limit of a server in megabytes. Unlike memory and
+// disk, 0 disables swap and -1 makes it unlimited.
+type SwapSize int64
+
+const (
+	SwapDisabled  SwapSize = 0
+	SwapUnlimited SwapSize = -1
+)
+
+// ParseSwapSize parses a swap size as ParseByteSize does, as well as
+// "unlimited" and "disabled".
+func ParseSwapSize(s string) (SwapSize, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "unlimited", "-1":
+		return SwapUnlimited, nil
+	case "disabled", "off", "none", "0":
+		return SwapDisabled, nil
+	}
+
+	b, err := ParseByteSize(s)
+	return SwapSize(b.Megabytes()), err
+}
+
+func (s SwapSize) Megabytes() int64 {
+	return int64(s)
+}
+
+func (s SwapSize) Unlimited() bool {
+	return s == SwapUnlimited
+}
+
+func (s SwapSize) Disabled() bool {
+	return s == SwapDisabled
+}
+
+func (s SwapSize) String() string {
+	switch {
+	case s == SwapUnlimited:
+		return "unlimited"
+	case s == SwapDisabled:
+		return "disabled"
+	case s < 0:
+		return strconv.FormatInt(int64(s), 10) + "MiB"
+	default:
+		return (ByteSize(s) * MiB).String()
+	}
+}
+
+func (s *SwapSize) UnmarshalText(text []byte) error {
+	size, err := ParseSwapSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = size
+	return nil
+}
+
+func (s *SwapSize) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		return s.UnmarshalText([]byte(str))
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+
+	*s = SwapSize(n)
+	return nil
+}
+
+// CPUFromCores converts a number of cores to a Limits.CPU percentage, where
+// 100 is one full thread and 0 means unlimited.
+func CPUFromCores(cores float64) int64 {
+	return int64(math.Round(cores * 100))
+}
+
+// maxCPUSetID is the highest CPU number the kernel supports.
+const maxCPUSetID = 8191
+
+// CPUSet is a sorted set of CPU numbers a server is pinned to, stored in
+// Limits.Threads as a list like "0-3,6". An empty set means no pinning.
+type CPUSet []int
+
+func NewCPUSet(cpus ...int) CPUSet {
+	set := CPUSet{}
+	seen := make(map[int]bool, len(cpus))
+	for _, cpu := range cpus {
+		if !seen[cpu] {
+			seen[cpu] = true
+			set = append(set, cpu)
+		}
+	}
+	sort.Ints(set)
+
+	return set
+}
+
+// ParseCPUSet parses a list of CPU numbers and ranges such as "0-3,6".
+func ParseCPUSet(s string) (CPUSet, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return CPUSet{}, nil
+	}
+
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			hi = lo
+		}
+
+		first, err := parseCPUID(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu set %q: %w", s, err)
+		}
+		last, err := parseCPUID(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu set %q: %w", s, err)
+		}
+		if first > last {
+			return nil, fmt.Errorf("invalid cpu set %q: range %s is reversed", s, part)
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return NewCPUSet(cpus...), nil
+}
+
+func parseCPUID(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not a cpu number", s)
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n > maxCPUSetID {
+		return 0, fmt.Errorf("cpu number %s is out of range", s)
+	}
+
+	return n, nil
+}
+
+func (s CPUSet) Contains(cpu int) bool {
+	i := sort.SearchInts(s, cpu)
+	return i < len(s) && s[i] == cpu
+}
+
+// String formats the set in the list format Limits.Threads expects, with
+// consecutive CPUs collapsed into ranges.
+func (s CPUSet) String() string {
+	var parts []string
+	for i := 0; i < len(s); {
+		j := i
+		for j+1 < len(s) && s[j+1] == s[j]+1 {
+			j++
+		}
+
+		if i == j {
+			parts = append(parts, strconv.Itoa(s[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(s[i])+"-"+strconv.Itoa(s[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (l *Limits) MemorySize() ByteSize {
+	return ByteSize(l.Memory) * MiB
+}
+
+func (l *Limits) DiskSize() ByteSize {
+	return ByteSize(l.Disk) * MiB
+}
+
+func (l *Limits) SwapSize() SwapSize {
+	return SwapSize(l.Swap)
+}
+
+// Cores returns the CPU limit as a number of cores, or 0 when unlimited.
+func (l *Limits) Cores() float64 {
+	return float64(l.CPU) / 100
+}
+
+func (l *Limits) CPUSet() (CPUSet, error) {
+	return ParseCPUSet(l.Threads)
+}
+
+// Validate checks the limits for values the panel rejects or that are
+// likely unit mistakes, such as a CPU limit above what the pinned threads
+// can provide.
+func (l *Limits) Validate() error {
+	switch {
+	case l.Memory < 0:
+		return errors.New("memory limit cannot be negative")
+	case l.Disk < 0:
+		return errors.New("disk limit cannot be negative")
+	case l.Swap < -1:
+		return errors.New("swap limit must be -1 (unlimited), 0 (disabled) or a size")
+	case l.CPU < 0:
+		return errors.New("cpu limit cannot be negative")
+	case l.IO < 10 || l.IO > 1000:
+		return errors.New("io weight must be between 10 and 1000")
+	}
+
+	set, err := l.CPUSet()
+	if err != nil {
+		return err
+	}
+	if len(set) > 0 && l.CPU > int64(len(set))*100 {
+		return fmt.Errorf("cpu limit of %d%% exceeds the %d pinned threads", l.CPU, len(set))
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package crocgodyl
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+		mb   int64
+		err  bool
+	}{
+		{in: "512", want: 512 * MiB, mb: 512},
+		{in: "512M", want: 512 * MiB, mb: 512},
+		{in: "2GiB", want: 2 * GiB, mb: 2048},
+		{in: "1.5 GB", want: 1536 * MiB, mb: 1536},
+		{in: "1t", want: TiB, mb: 1 << 20},
+		{in: "2048kb", want: 2 * MiB, mb: 2},
+		{in: "unlimited", want: Unlimited},
+		{in: " 0 ", want: Unlimited},
+		{in: "1536KiB", err: true},
+		{in: "0.5", err: true},
+		{in: "1PB", err: true},
+		{in: "GB", err: true},
+		{in: "-1", err: true},
+		{in: "9999999999999999T", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %v, expected an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseByteSize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want || got.Megabytes() != tt.mb {
+			t.Errorf("ParseByteSize(%q) = %d (%d MB), want %d (%d MB)", tt.in, got, got.Megabytes(), tt.want, tt.mb)
+		}
+	}
+}
+
+func TestByteSizeUnits(t *testing.T) {
+	if b := MustParseByteSize("1GiB"); b.Bytes() != 1<<30 || b.Megabytes() != 1024 {
+		t.Fatalf("unexpected 1GiB: %d bytes, %d MB", b.Bytes(), b.Megabytes())
+	}
+
+	tests := map[ByteSize]string{
+		Unlimited:  "unlimited",
+		2 * GiB:    "2GiB",
+		1536 * MiB: "1536MiB",
+		3 * TiB:    "3TiB",
+		KiB:        "1KiB",
+		100:        "100B",
+	}
+	for b, want := range tests {
+		if got := b.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", int64(b), got, want)
+		}
+	}
+
+	limits := Limits{Memory: 2048, Disk: 0, Swap: -1}
+	if limits.MemorySize() != 2*GiB || limits.DiskSize() != Unlimited || !limits.SwapSize().Unlimited() {
+		t.Fatalf("unexpected sizes %v %v %v", limits.MemorySize(), limits.DiskSize(), limits.SwapSize())
+	}
+}
+
+func TestByteSizeJSON(t *testing.T) {
+	var v struct {
+		Memory ByteSize `json:"memory"`
+		Disk   ByteSize `json:"disk"`
+		Swap   SwapSize `json:"swap"`
+		Other  SwapSize `json:"other"`
+	}
+	if err := json.Unmarshal([]byte(`{"memory":1024,"disk":"10G","swap":"512M","other":"unlimited"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Memory != GiB || v.Disk != 10*GiB {
+		t.Fatalf("unexpected sizes %v, %v", v.Memory, v.Disk)
+	}
+	if v.Swap.Megabytes() != 512 || v.Swap.String() != "512MiB" || v.Other != SwapUnlimited {
+		t.Fatalf("unexpected swap %v, %v", v.Swap, v.Other)
+	}
+
+	if err := json.Unmarshal([]byte(`{"memory":"lots"}`), &v); err == nil {
+		t.Fatal("expected an invalid size to be rejected")
+	}
+}
+
+func TestParseSwapSize(t *testing.T) {
+	tests := map[string]SwapSize{
+		"unlimited": SwapUnlimited,
+		"-1":        SwapUnlimited,
+		"off":       SwapDisabled,
+		"0":         SwapDisabled,
+		"1G":        1024,
+	}
+	for in, want := range tests {
+		if got, err := ParseSwapSize(in); err != nil || got != want {
+			t.Errorf("ParseSwapSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+}
+
+func TestParseCPUSet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "", want: ""},
+		{in: "0-3,6", want: "0-3,6"},
+		{in: "6, 1,0,2,2", want: "0-2,6"},
+		{in: "3-1", err: true},
+		{in: "a", err: true},
+		{in: "0-9000", err: true},
+	}
+
+	for _, tt := range tests {
+		set, err := ParseCPUSet(tt.in)
+		if tt.err != (err != nil) {
+			t.Errorf("ParseCPUSet(%q): unexpected error %v", tt.in, err)
+			continue
+		}
+		if err == nil && set.String() != tt.want {
+			t.Errorf("ParseCPUSet(%q) = %q, want %q", tt.in, set, tt.want)
+		}
+	}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	valid := Limits{Memory: 1024, Swap: 0, Disk: 2048, IO: 500, CPU: 200}
+
+	tests := []struct {
+		name   string
+		modify func(l *Limits)
+		err    bool
+	}{
+		{name: "valid", modify: func(l *Limits) {}},
+		{name: "unlimited swap", modify: func(l *Limits) { l.Swap = -1 }},
+		{name: "lowest io", modify: func(l *Limits) { l.IO = 10 }},
+		{name: "highest io", modify: func(l *Limits) { l.IO = 1000 }},
+		{name: "io too low", modify: func(l *Limits) { l.IO = 9 }, err: true},
+		{name: "io too high", modify: func(l *Limits) { l.IO = 1001 }, err: true},
+		{name: "negative memory", modify: func(l *Limits) { l.Memory = -1 }, err: true},
+		{name: "negative disk", modify: func(l *Limits) { l.Disk = -1 }, err: true},
+		{name: "invalid swap", modify: func(l *Limits) { l.Swap = -2 }, err: true},
+		{name: "negative cpu", modify: func(l *Limits) { l.CPU = -1 }, err: true},
+		{name: "cpu within threads", modify: func(l *Limits) { l.Threads = "0-1" }},
+		{name: "cpu above threads", modify: func(l *Limits) { l.Threads = "0" }, err: true},
+		{name: "invalid threads", modify: func(l *Limits) { l.Threads = "x" }, err: true},
+	}
+
+	for _, tt := range tests {
+		l := valid
+		tt.modify(&l)
+		if err := l.Validate(); tt.err != (err != nil) {
+			t.Errorf("%s: unexpected result %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package crocgodyl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryFS is an in-memory WritableFS behaving like ServerFS, including the
+// naming used by Copy. Directories are created implicitly by writes, as
+// Wings does.
+type MemoryFS struct {
+	mu    sync.RWMutex
+	files map[string]*memoryFile
+	now   func() time.Time
+}
+
+var _ WritableFS = (*MemoryFS)(nil)
+
+// memoryFile is a file or directory of a MemoryFS. Its data is replaced as
+// a whole on writes and never modified in place, so readers may keep it.
+type memoryFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func NewMemoryFS() *MemoryFS {
+	return &MemoryFS{files: map[string]*memoryFile{}, now: time.Now}
+}
+
+type memoryFileInfo struct {
+	name string
+	file *memoryFile
+}
+
+func (i *memoryFileInfo) Name() string               { return i.name }
+func (i *memoryFileInfo) Size() int64                { return int64(len(i.file.data)) }
+func (i *memoryFileInfo) Mode() fs.FileMode          { return i.file.mode }
+func (i *memoryFileInfo) ModTime() time.Time         { return i.file.modTime }
+func (i *memoryFileInfo) IsDir() bool                { return i.file.mode.IsDir() }
+func (i *memoryFileInfo) Sys() any                   { return nil }
+func (i *memoryFileInfo) Type() fs.FileMode          { return i.file.mode.Type() }
+func (i *memoryFileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+type memoryReader struct {
+	info *memoryFileInfo
+	*bytes.Reader
+}
+
+func (r *memoryReader) Stat() (fs.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *memoryReader) Close() error {
+	return nil
+}
+
+type memoryDir struct {
+	info    *memoryFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memoryDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *memoryDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *memoryDir) Close() error {
+	return nil
+}
+
+func (d *memoryDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+
+	d.offset += n
+	return rest[:n], nil
+}
+
+func (m *MemoryFS) stat(op, name string) (*memoryFileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &memoryFileInfo{name: path.Base(name), file: f}, nil
+}
+
+// entries lists the children of the directory dir, including directories
+// that only exist implicitly through the files below them.
+func (m *MemoryFS) entries(dir string) []fs.DirEntry {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	children := map[string]*memoryFile{}
+	for name, f := range m.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		child, _, nested := strings.Cut(strings.TrimPrefix(name, prefix), "/")
+		if !nested {
+			children[child] = f
+		} else if _, ok := children[child]; !ok {
+			children[child] = &memoryFile{mode: fs.ModeDir | 0o755}
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for name, f := range children {
+		entries = append(entries, &memoryFileInfo{name: name, file: f})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries
+}
+
+func (m *MemoryFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &memoryDir{info: info, entries: m.entries(name)}, nil
+	}
+
+	return &memoryReader{info: info, Reader: bytes.NewReader(info.file.data)}, nil
+}
+
+func (m *MemoryFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return m.entries(name), nil
+}
+
+func (m *MemoryFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (m *MemoryFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.stat("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+
+	return append([]byte(nil), info.file.data...), nil
+}
+
+func (m *MemoryFS) lookup(name string) (*memoryFile, bool) {
+	if name == "." {
+		return &memoryFile{mode: fs.ModeDir | 0o755}, true
+	}
+
+	if f, ok := m.files[name]; ok {
+		return f, true
+	}
+
+	prefix := name + "/"
+	for other := range m.files {
+		if strings.HasPrefix(other, prefix) {
+			return &memoryFile{mode: fs.ModeDir | 0o755}, true
+		}
+	}
+
+	return nil, false
+}
+
+func (m *MemoryFS) mkdirs(dir string) error {
+	for dir != "." {
+		if f, ok := m.files[dir]; ok {
+			if !f.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+			}
+		} else {
+			m.files[dir] = &memoryFile{mode: fs.ModeDir | 0o755, modTime: m.now()}
+		}
+		dir = path.Dir(dir)
+	}
+
+	return nil
+}
+
+func (m *MemoryFS) put(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.lookup(name); ok {
+		if f.mode.IsDir() {
+			return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+		}
+		perm = f.mode.Perm()
+	}
+	if err := m.mkdirs(path.Dir(name)); err != nil {
+		return err
+	}
+
+	m.files[name] = &memoryFile{data: data, mode: perm.Perm(), modTime: m.now()}
+	return nil
+}
+
+type memoryFileWriter struct {
+	fsys   *MemoryFS
+	name   string
+	perm   fs.FileMode
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *memoryFileWriter) Name() string {
+	return w.name
+}
+
+func (w *memoryFileWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	return w.buf.Write(b)
+}
+
+func (w *memoryFileWriter) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+	w.closed = true
+
+	return w.fsys.put(w.name, append([]byte(nil), w.buf.Bytes()...), w.perm)
+}
+
+func (m *MemoryFS) Create(name string) (WritableFile, error) {
+	return m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+func (m *MemoryFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if err := validWritePath("open", name); err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("only write access is supported")}
+	}
+
+	m.mu.RLock()
+	f, exists := m.lookup(name)
+	m.mu.RUnlock()
+
+	switch {
+	case exists && f.mode.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	w := &memoryFileWriter{fsys: m, name: name, perm: perm}
+	if exists && flag&os.O_APPEND != 0 && flag&os.O_TRUNC == 0 {
+		w.buf.Write(f.data)
+	}
+
+	return w, nil
+}
+
+func (m *MemoryFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := validWritePath("write", name); err != nil {
+		return err
+	}
+
+	return m.put(name, append([]byte(nil), data...), perm)
+}
+
+func (m *MemoryFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := validWritePath("mkdir", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(name); ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	parent, ok := m.lookup(path.Dir(name))
+	if !ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("parent is not a directory")}
+	}
+
+	m.files[name] = &memoryFile{mode: fs.ModeDir | perm.Perm(), modTime: m.now()}
+	return nil
+}
+
+func (m *MemoryFS) MkdirAll(name string, perm fs.FileMode) error {
+	if name == "." {
+		return nil
+	}
+	if err := validWritePath("mkdir", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mkdirs(name)
+}
+
+func (m *MemoryFS) Remove(name string) error {
+	if err := validWritePath("remove", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.lookup(name)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.mode.IsDir() {
+		prefix := name + "/"
+		for other := range m.files {
+			if strings.HasPrefix(other, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+	}
+
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemoryFS) RemoveAll(name string) error {
+	if err := validWritePath("remove", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := name + "/"
+	for other := range m.files {
+		if other == name || strings.HasPrefix(other, prefix) {
+			delete(m.files, other)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryFS) Rename(oldname, newname string) error {
+	if err := validWritePath("rename", oldname); err != nil {
+		return err
+	}
+	if err := validWritePath("rename", newname); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(oldname); !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.lookup(newname); ok {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+	}
+	if strings.HasPrefix(newname, oldname+"/") {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	if err := m.mkdirs(path.Dir(newname)); err != nil {
+		return err
+	}
+
+	prefix := oldname + "/"
+	moved := map[string]*memoryFile{}
+	for other, f := range m.files {
+		switch {
+		case other == oldname:
+			moved[newname] = f
+		case strings.HasPrefix(other, prefix):
+			moved[newname+"/"+strings.TrimPrefix(other, prefix)] = f
+		default:
+			continue
+		}
+		delete(m.files, other)
+	}
+	for name, f := range moved {
+		m.files[name] = f
+	}
+
+	return nil
+}
+
+func (m *MemoryFS) Chmod(name string, mode fs.FileMode) error {
+	if err := validWritePath("chmod", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.lookup(name)
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+
+	cp := *f
+	cp.mode = f.mode.Type() | mode.Perm()
+	m.files[name] = &cp
+	return nil
+}
+
+func (m *MemoryFS) Copy(name string) error {
+	if err := validWritePath("copy", name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.lookup(name)
+	if !ok {
+		return &fs.PathError{Op: "copy", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.mode.IsDir() {
+		return &fs.PathError{Op: "copy", Path: name, Err: errors.New("is a directory")}
+	}
+
+	target := copyName(name, func(candidate string) bool {
+		_, taken := m.lookup(candidate)
+		return taken
+	})
+
+	m.files[target] = &memoryFile{data: f.data, mode: f.mode, modTime: m.now()}
+	return nil
+}
+
+// copyName mirrors how Wings names copies: "a.txt" becomes "a copy.txt",
+// then "a copy 1.txt", "a copy 2.txt" and so on.
+func copyName(name string, taken func(string) bool) string {
+	dir, base := path.Split(name)
+
+	ext := path.Ext(base)
+	if strings.HasSuffix(strings.ToLower(base), ".tar.gz") {
+		ext = base[len(base)-len(".tar.gz"):]
+	}
+	stem := strings.TrimSuffix(base, ext)
+
+	candidate := dir + stem + " copy" + ext
+	for i := 1; taken(candidate); i++ {
+		candidate = dir + stem + " copy " + strconv.Itoa(i) + ext
+	}
+
+	return candidate
+}
+
+// Files lists every regular file path, sorted, which is handy in tests.
+func (m *MemoryFS) Files() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.files))
+	for name, f := range m.files {
+		if !f.mode.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,26 @@
+package crocgodyl
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemoryFS(t *testing.T) {
+	m := NewMemoryFS()
+	m.WriteFile("server.properties", []byte("motd=hi\n"), 0o644)
+	m.WriteFile("plugins/a.jar", []byte("a"), 0o644)
+	m.WriteFile("plugins/config/a.yml", []byte("a: 1\n"), 0o644)
+	m.MkdirAll("world/region", 0o755)
+	m.Copy("server.properties")
+
+	if err := fstest.TestFS(m, "server.properties", "server copy.properties", "plugins/a.jar", "plugins/config/a.yml", "world/region"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Rename("plugins", "mods"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(m, "mods/a.jar", "mods/config/a.yml"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,294 @@
+package crocgodyl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPanel serves the file manager endpoints of the client API from m,
+// the way the panel and Wings would.
+func newTestPanel(t *testing.T, m *MemoryFS) *Client {
+	t.Helper()
+
+	return newTestPanelWith(t, m, nil)
+}
+
+// newTestPanelWith is newTestPanel with the handler passed through wrap, so
+// that tests can inject failures.
+func newTestPanelWith(t *testing.T, m *MemoryFS, wrap func(http.Handler) http.Handler) *Client {
+	t.Helper()
+
+	rel := func(p string) string {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if p == "" {
+			return "."
+		}
+		return p
+	}
+	attributes := func(info fs.FileInfo) map[string]interface{} {
+		modified := info.ModTime().Format(time.RFC3339Nano)
+		mime := "text/plain"
+		if info.IsDir() {
+			mime = "inode/directory"
+		}
+
+		return map[string]interface{}{"attributes": map[string]interface{}{
+			"name":        info.Name(),
+			"is_file":     !info.IsDir(),
+			"size":        info.Size(),
+			"mode_bits":   fmt.Sprintf("%o", info.Mode().Perm()),
+			"mimetype":    mime,
+			"created_at":  modified,
+			"modified_at": modified,
+		}}
+	}
+	fail := func(w http.ResponseWriter, code int) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"errors":[{"code":"Error","status":"%d","detail":"error"}]}`, code)
+	}
+
+	// Signed URLs carry a token that Wings accepts only once.
+	var (
+		mu     sync.Mutex
+		tokens int
+		used   = map[string]bool{}
+		srv    *httptest.Server
+	)
+	sign := func(u string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		tokens++
+		return fmt.Sprintf("%s%s&token=%d", srv.URL, u, tokens)
+	}
+	redeem := func(token string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if used[token] {
+			return false
+		}
+		used[token] = true
+		return true
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		p := r.URL.Path
+
+		switch {
+		case strings.HasSuffix(p, "/files/list"):
+			entries, err := m.ReadDir(rel(q.Get("directory")))
+			if err != nil {
+				fail(w, http.StatusNotFound)
+				return
+			}
+
+			var data []interface{}
+			for _, e := range entries {
+				info, _ := e.Info()
+				data = append(data, attributes(info))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+
+		case strings.HasSuffix(p, "/files/contents"):
+			b, err := m.ReadFile(rel(q.Get("file")))
+			if err != nil {
+				fail(w, http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+
+		case strings.HasSuffix(p, "/files/write"):
+			b, _ := io.ReadAll(r.Body)
+			if err := m.WriteFile(rel(q.Get("file")), b, 0o644); err != nil {
+				fail(w, http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/create-folder"):
+			var body CreateFolderDescriptor
+			json.NewDecoder(r.Body).Decode(&body)
+			if err := m.MkdirAll(rel(path.Join(body.Root, body.Name)), 0o755); err != nil {
+				fail(w, http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/delete"):
+			var body DeleteFilesDescriptor
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, f := range body.Files {
+				m.RemoveAll(rel(path.Join(body.Root, f)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/rename"):
+			var body RenameDescriptor
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, f := range body.Files {
+				if err := m.Rename(rel(path.Join(body.Root, f.From)), rel(path.Join(body.Root, f.To))); err != nil {
+					fail(w, http.StatusBadRequest)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/copy"):
+			var body struct {
+				Location string `json:"location"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if err := m.Copy(rel(body.Location)); err != nil {
+				fail(w, http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/chmod"):
+			var body ChmodDescriptor
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, f := range body.Files {
+				// Wings takes the octal digits as a decimal number.
+				mode, _ := strconv.ParseUint(strconv.FormatUint(uint64(f.Mode), 10), 8, 32)
+				if err := m.Chmod(rel(path.Join(body.Root, f.File)), fs.FileMode(mode)); err != nil {
+					fail(w, http.StatusBadRequest)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/compress"):
+			var body CompressDescriptor
+			json.NewDecoder(r.Body).Decode(&body)
+
+			buf := bytes.Buffer{}
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			for _, f := range body.Files {
+				fs.WalkDir(m, rel(path.Join(body.Root, f)), func(name string, d fs.DirEntry, err error) error {
+					if err != nil || d.IsDir() {
+						return err
+					}
+					b, _ := m.ReadFile(name)
+					tw.WriteHeader(&tar.Header{Name: strings.TrimPrefix(name, rel(body.Root)+"/"), Mode: 0o644, Size: int64(len(b))})
+					tw.Write(b)
+					return nil
+				})
+			}
+			tw.Close()
+			gz.Close()
+
+			mu.Lock()
+			tokens++
+			name := rel(path.Join(body.Root, fmt.Sprintf("archive-%d.tar.gz", tokens)))
+			mu.Unlock()
+			m.WriteFile(name, buf.Bytes(), 0o644)
+
+			info, _ := m.Stat(name)
+			json.NewEncoder(w).Encode(attributes(info))
+
+		case strings.HasSuffix(p, "/files/decompress"):
+			var body DecompressDescriptor
+			json.NewDecoder(r.Body).Decode(&body)
+
+			b, err := m.ReadFile(rel(path.Join(body.Root, body.File)))
+			if err != nil {
+				fail(w, http.StatusNotFound)
+				return
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				fail(w, http.StatusBadRequest)
+				return
+			}
+			tr := tar.NewReader(gz)
+			for {
+				hdr, err := tr.Next()
+				if err != nil {
+					break
+				}
+				data, _ := io.ReadAll(tr)
+				m.WriteFile(rel(path.Join(body.Root, hdr.Name)), data, 0o644)
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case strings.HasSuffix(p, "/files/upload"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"attributes": map[string]interface{}{
+				"url": sign("/upload/file?"),
+			}})
+
+		case strings.HasSuffix(p, "/files/download"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"attributes": map[string]interface{}{
+				"url": sign("/download/file?file=" + url.QueryEscape(q.Get("file"))),
+			}})
+
+		case p == "/download/file":
+			if !redeem(q.Get("token")) {
+				fail(w, http.StatusNotFound)
+				return
+			}
+
+			name := rel(q.Get("file"))
+			info, err := m.Stat(name)
+			if err != nil {
+				fail(w, http.StatusNotFound)
+				return
+			}
+			b, _ := m.ReadFile(name)
+			w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(b)))
+			http.ServeContent(w, r, path.Base(name), info.ModTime(), bytes.NewReader(b))
+
+		case p == "/upload/file":
+			if !redeem(q.Get("token")) {
+				fail(w, http.StatusNotFound)
+				return
+			}
+
+			reader, err := r.MultipartReader()
+			if err != nil {
+				fail(w, http.StatusBadRequest)
+				return
+			}
+			for {
+				part, err := reader.NextPart()
+				if err != nil {
+					break
+				}
+				b, _ := io.ReadAll(part)
+				m.WriteFile(rel(path.Join(q.Get("directory"), part.FileName())), b, 0o644)
+			}
+
+		default:
+			t.Logf("unhandled request %s %s", r.Method, p)
+			fail(w, http.StatusNotFound)
+		}
+	})
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	srv = httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(srv.URL, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}